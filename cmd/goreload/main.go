@@ -2,17 +2,27 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
 	"github.com/taro33333/goreload/internal/config"
 	"github.com/taro33333/goreload/internal/engine"
+	"github.com/taro33333/goreload/internal/events"
 	"github.com/taro33333/goreload/internal/logger"
+	"github.com/taro33333/goreload/internal/project"
 )
 
 // Build information set by ldflags.
@@ -30,22 +40,33 @@ func main() {
 
 func rootCmd() *cobra.Command {
 	var configPath string
+	var profile string
+	var out outputOptions
 
 	cmd := &cobra.Command{
 		Use:   "goreload",
 		Short: "Hot reload for Go applications",
 		Long:  "goreload watches your Go files and automatically rebuilds and restarts your application.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return run(configPath)
+			if !cmd.Flags().Changed("config") {
+				if path := config.Find("."); path != "" {
+					configPath = path
+				}
+			}
+			return run(configPath, profile, out)
 		},
 		SilenceUsage:  true,
 		SilenceErrors: true,
 	}
 
 	cmd.Flags().StringVarP(&configPath, "config", "c", config.DefaultConfigFile, "config file path")
+	cmd.Flags().StringVarP(&profile, "profile", "p", "", "config profile to apply (env: "+config.ProfileEnv+")")
+	cmd.Flags().StringVar(&out.format, "output", "text", "output format: text, or json for a stream of lifecycle events")
+	cmd.Flags().StringVar(&out.file, "output-file", "", "write the json events to this file instead of stdout")
 
 	cmd.AddCommand(versionCmd())
 	cmd.AddCommand(initCmd())
+	cmd.AddCommand(migrateCmd())
 
 	return cmd
 }
@@ -63,37 +84,233 @@ func versionCmd() *cobra.Command {
 }
 
 func initCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		output string
+		target string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "init",
-		Short: "Generate a default configuration file",
+		Short: "Generate a configuration file for the current project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.Exists(output) && !force {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", output)
+			}
+
+			info, err := project.Inspect(".")
+			if err != nil {
+				return fmt.Errorf("inspect project: %w", err)
+			}
+			if info.WorkFile != "" {
+				fmt.Printf("Detected go.work with %d modules\n", len(info.WorkModules))
+			}
+
+			pkg, err := chooseMain(cmd, info, target)
+			if err != nil {
+				return err
+			}
+
+			opts := config.InitOptions{
+				BuildCmd: config.DefaultBuildCmd,
+				Bin:      config.DefaultBin,
+				TmpDir:   config.DefaultTmpDir,
+			}
+			if pkg != "" && pkg != "." {
+				opts.Bin = "./" + path.Join(opts.TmpDir, path.Base(pkg))
+				opts.BuildCmd = fmt.Sprintf("go build -o %s ./%s", opts.Bin, pkg)
+			}
+
+			if err := config.WriteInit(output, opts); err != nil {
+				return fmt.Errorf("write config: %w", err)
+			}
+			fmt.Printf("Created %s (build: %s)\n", output, opts.BuildCmd)
+
+			added, err := project.EnsureGitignore(info.Root, opts.TmpDir)
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Printf("Added /%s/ to .gitignore\n", opts.TmpDir)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", config.DefaultConfigFile, "output file path")
+	cmd.Flags().StringVarP(&target, "target", "t", "", "main package directory to build, e.g. cmd/api")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "overwrite an existing config file")
+
+	return cmd
+}
+
+// chooseMain picks the main package to build. An explicit target wins;
+// otherwise the only candidate is used, or the user is asked when stdin is a
+// terminal. It returns an empty string when the project has no main package.
+func chooseMain(cmd *cobra.Command, info *project.Info, target string) (string, error) {
+	if target != "" {
+		target = path.Clean(filepath.ToSlash(target))
+		if !slices.Contains(info.Mains, target) {
+			return "", fmt.Errorf("%s is not a main package (found: %s)", target, strings.Join(info.Mains, ", "))
+		}
+		return target, nil
+	}
+
+	switch len(info.Mains) {
+	case 0:
+		fmt.Println("No main package found, using the default build command")
+		return "", nil
+	case 1:
+		return info.Mains[0], nil
+	}
+
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return "", fmt.Errorf("multiple main packages found, choose one with --target: %s", strings.Join(info.Mains, ", "))
+	}
+
+	fmt.Println("Multiple main packages found:")
+	for i, m := range info.Mains {
+		fmt.Printf("  %d) %s\n", i+1, m)
+	}
+
+	reader := bufio.NewReader(cmd.InOrStdin())
+	for {
+		fmt.Printf("Select the package to build [1-%d] (default 1): ", len(info.Mains))
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return "", fmt.Errorf("read selection: %w", err)
+			}
+			return info.Mains[0], nil
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(info.Mains) {
+			return info.Mains[n-1], nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid selection %q", line)
+		}
+		fmt.Printf("Invalid selection %q\n", line)
+	}
+}
+
+func migrateCmd() *cobra.Command {
+	var (
+		from   string
+		output string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Convert another tool's configuration to goreload.yaml",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if config.Exists(config.DefaultConfigFile) {
-				return fmt.Errorf("%s already exists", config.DefaultConfigFile)
+			if from != "air" {
+				return fmt.Errorf("unsupported source %q (supported: air)", from)
+			}
+
+			src := config.DefaultAirConfigFile
+			if len(args) > 0 {
+				src = args[0]
+			}
+
+			if config.Exists(output) && !force {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", output)
+			}
+
+			m, err := config.FromAir(src)
+			if err != nil {
+				return err
 			}
 
-			if err := config.WriteDefault(config.DefaultConfigFile); err != nil {
+			for _, w := range m.Warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+			}
+
+			header := fmt.Sprintf("# goreload configuration file\n# Migrated from %s", src)
+			if err := config.Write(output, m.Config, header, m.Keys...); err != nil {
 				return fmt.Errorf("write config: %w", err)
 			}
 
-			fmt.Printf("Created %s\n", config.DefaultConfigFile)
+			fmt.Printf("Created %s from %s\n", output, src)
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&from, "from", "air", "tool to migrate from (air)")
+	cmd.Flags().StringVarP(&output, "output", "o", config.DefaultConfigFile, "output file path")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "overwrite an existing output file")
+
+	return cmd
+}
+
+// outputOptions holds the --output and --output-file flags.
+type outputOptions struct {
+	format string
+	file   string
+}
+
+// openEvents returns the event stream selected by out, or nil for text
+// output, along with a function that closes it.
+func openEvents(out outputOptions) (*events.Stream, func(), error) {
+	switch out.format {
+	case "text":
+		if out.file != "" {
+			return nil, nil, fmt.Errorf("--output-file requires --output json")
+		}
+		return nil, func() {}, nil
+	case "json":
+	default:
+		return nil, nil, fmt.Errorf("--output must be text or json, got %q", out.format)
+	}
+
+	if out.file == "" {
+		return events.NewStream(os.Stdout), func() {}, nil
+	}
+	f, err := os.Create(out.file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open output file: %w", err)
+	}
+	return events.NewStream(f), func() { _ = f.Close() }, nil
 }
 
-func run(configPath string) error {
+func run(configPath, profile string, out outputOptions) error {
+	stream, closeEvents, err := openEvents(out)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	// With events on stdout, everything else goes to stderr.
+	stdout := io.Writer(os.Stdout)
+	if stream != nil && out.file == "" {
+		stdout = os.Stderr
+	}
+
+	// A profile from the environment may be meant for other projects, so
+	// only --profile requires a config file.
+	envProfile := ""
+	if profile == "" {
+		envProfile = os.Getenv(config.ProfileEnv)
+	}
+
 	// Load configuration.
 	var cfg *config.Config
-	var err error
 
 	if config.Exists(configPath) {
-		cfg, err = config.LoadWithDefaults(configPath)
+		if envProfile != "" {
+			profile = envProfile
+		}
+		cfg, err = config.LoadProfile(configPath, profile)
 		if err != nil {
 			return fmt.Errorf("load config: %w", err)
 		}
 	} else if configPath != config.DefaultConfigFile {
 		// User specified a non-default config file that doesn't exist.
 		return fmt.Errorf("config file not found: %s", configPath)
+	} else if profile != "" {
+		return fmt.Errorf("profile %s requires a config file", profile)
 	} else {
 		// Use defaults if no config file exists.
 		cfg = config.Default()
@@ -105,12 +322,16 @@ func run(configPath string) error {
 		Time:  cfg.Log.Time,
 		Level: cfg.Log.Level,
 	})
+	log.SetOutput(stdout)
+	if envProfile != "" && profile == "" {
+		log.Debug("ignoring %s=%s without a config file", config.ProfileEnv, envProfile)
+	}
 
 	// Print banner.
-	logger.Banner(os.Stdout, Version)
+	logger.Banner(stdout, Version)
 
 	// Create engine.
-	eng, err := engine.New(cfg, log)
+	eng, err := engine.New(cfg, log, engine.Options{Events: stream, Stdout: stdout})
 	if err != nil {
 		return fmt.Errorf("create engine: %w", err)
 	}
@@ -127,6 +348,20 @@ func run(configPath string) error {
 		cancel()
 	}()
 
+	// Toggle pausing on SIGUSR1.
+	pauseCh := make(chan os.Signal, 1)
+	notifyPause(pauseCh)
+
+	go func() {
+		for range pauseCh {
+			if eng.Paused() {
+				eng.Resume()
+			} else {
+				eng.Pause()
+			}
+		}
+	}()
+
 	// Run engine.
 	if err := eng.Run(ctx); err != nil && err != context.Canceled {
 		return err
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyPause relays the signal that toggles pausing, SIGUSR1, to ch.
+func notifyPause(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGUSR1)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyPause does nothing: Windows has no SIGUSR1. Use the pause file
+// instead.
+func notifyPause(ch chan<- os.Signal) {}
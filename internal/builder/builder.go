@@ -18,6 +18,8 @@ type Result struct {
 	Output   string
 	Duration time.Duration
 	Error    error
+	// Diagnostics are the file positions and messages found in Output.
+	Diagnostics []Diagnostic
 }
 
 // Builder executes build commands and manages build artifacts.
@@ -95,10 +97,11 @@ func (b *builder) Build(ctx context.Context) Result {
 			}
 		}
 		return Result{
-			Success:  false,
-			Output:   output,
-			Duration: duration,
-			Error:    fmt.Errorf("build failed: %w", err),
+			Success:     false,
+			Output:      output,
+			Duration:    duration,
+			Error:       fmt.Errorf("build failed: %w", err),
+			Diagnostics: ParseDiagnostics(output, b.cfg.Root),
 		}
 	}
 
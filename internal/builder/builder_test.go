@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -228,3 +229,75 @@ func TestParseCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGoBuild(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		want   GoBuild
+		wantOK bool
+	}{
+		{
+			cmd:    "go build -o ./tmp/main .",
+			want:   GoBuild{Packages: []string{"."}},
+			wantOK: true,
+		},
+		{
+			cmd:    "go build -o ./tmp/main",
+			want:   GoBuild{Packages: []string{"."}},
+			wantOK: true,
+		},
+		{
+			cmd:    `go build -race -tags "dev,sqlite" -ldflags "-s -w" -o ./tmp/api ./cmd/api`,
+			want:   GoBuild{Packages: []string{"./cmd/api"}, Tags: []string{"dev", "sqlite"}},
+			wantOK: true,
+		},
+		{
+			cmd:    "go build -tags=integration -C services/api -o=../../tmp/api ./cmd/api ./cmd/worker",
+			want:   GoBuild{Packages: []string{"./cmd/api", "./cmd/worker"}, Tags: []string{"integration"}, Dir: "services/api"},
+			wantOK: true,
+		},
+		{cmd: "make build", wantOK: false},
+		{cmd: "go run .", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			got, ok := ParseGoBuild(tt.cmd)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseGoBuild() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) && ok {
+				t.Errorf("ParseGoBuild() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "project")
+	output := "# example.com/app\n" +
+		"./main.go:5:2: undefined: foo\n" +
+		"internal/db/db.go:12:9: cannot use x (variable of type int) as string value in return statement\n" +
+		filepath.Join(root, "cmd", "api", "main.go") + ":3:1: missing return\n" +
+		"./handler.go:20:15: impossible type assertion: r.(T)\n" +
+		"\tT does not implement io.Reader (missing method Read)\n" +
+		"vet.go:7: result of fmt.Sprintf call not used\n" +
+		"too many errors\n"
+
+	want := []Diagnostic{
+		{File: "main.go", Line: 5, Column: 2, Message: "undefined: foo"},
+		{File: "internal/db/db.go", Line: 12, Column: 9, Message: "cannot use x (variable of type int) as string value in return statement"},
+		{File: "cmd/api/main.go", Line: 3, Column: 1, Message: "missing return"},
+		{File: "handler.go", Line: 20, Column: 15, Message: "impossible type assertion: r.(T)\nT does not implement io.Reader (missing method Read)"},
+		{File: "vet.go", Line: 7, Message: "result of fmt.Sprintf call not used"},
+	}
+
+	got := ParseDiagnostics(output, root)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDiagnostics() = %+v, want %+v", got, want)
+	}
+
+	if got := ParseDiagnostics("", root); got == nil || len(got) != 0 {
+		t.Errorf("ParseDiagnostics(\"\") = %#v, want an empty slice", got)
+	}
+}
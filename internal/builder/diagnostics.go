@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a compiler or tool message about a position in a file.
+type Diagnostic struct {
+	// File is the path relative to the project root, with "/" separators,
+	// or the path as printed when it is outside the root.
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Column is 0 when the message has none.
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// diagnosticLine matches "file:line: message" and "file:line:column: message",
+// allowing a Windows drive letter.
+var diagnosticLine = regexp.MustCompile(`^((?:[A-Za-z]:)?[^:\s][^:]*):(\d+)(?::(\d+))?: (.+)$`)
+
+// ParseDiagnostics extracts the file positions and messages from build output,
+// such as the errors printed by the go command. Indented lines that follow a
+// message, such as "have" and "want" details, are appended to it. Relative
+// paths are taken relative to root.
+func ParseDiagnostics(output, root string) []Diagnostic {
+	diags := []Diagnostic{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if strings.HasPrefix(line, "\t") && len(diags) > 0 {
+			d := &diags[len(diags)-1]
+			d.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		m := diagnosticLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		diags = append(diags, Diagnostic{
+			File:    diagnosticFile(m[1], root),
+			Line:    lineNo,
+			Column:  col,
+			Message: m[4],
+		})
+	}
+	return diags
+}
+
+func diagnosticFile(path, root string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(filepath.Clean(path))
+	}
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// GoBuild describes a "go build" command line.
+type GoBuild struct {
+	// Packages are the package patterns being built, "." when none are given.
+	Packages []string
+	// Tags are the build tags given with -tags.
+	Tags []string
+	// Dir is the directory given with -C, if any.
+	Dir string
+}
+
+// goBuildValueFlags are the "go build" flags that take a value.
+var goBuildValueFlags = map[string]bool{
+	"C": true, "o": true, "p": true, "tags": true, "mod": true, "modfile": true,
+	"overlay": true, "pgo": true, "pkgdir": true, "toolexec": true,
+	"buildmode": true, "compiler": true, "installsuffix": true,
+	"covermode": true, "coverpkg": true, "asmflags": true, "gcflags": true,
+	"gccgoflags": true, "ldflags": true,
+}
+
+// ParseGoBuild parses a build command of the form "go build [flags]
+// [packages]". It reports false for any other command, such as make or a
+// shell script.
+func ParseGoBuild(cmd string) (GoBuild, bool) {
+	args := parseCommand(cmd)
+	if len(args) < 2 || strings.TrimSuffix(filepath.Base(args[0]), ".exe") != "go" || args[1] != "build" {
+		return GoBuild{}, false
+	}
+
+	var gb GoBuild
+	for i := 2; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			gb.Packages = append(gb.Packages, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if goBuildValueFlags[name] && !hasValue {
+			if i+1 >= len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "tags":
+			gb.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		case "C":
+			gb.Dir = value
+		}
+	}
+
+	if len(gb.Packages) == 0 {
+		gb.Packages = []string{"."}
+	}
+	return gb, true
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultAirConfigFile is the configuration file name used by air.
+const DefaultAirConfigFile = ".air.toml"
+
+// airConfig mirrors the subset of air's .air.toml that maps onto goreload.
+type airConfig struct {
+	Root   string         `toml:"root"`
+	TmpDir string         `toml:"tmp_dir"`
+	Build  airBuildConfig `toml:"build"`
+	Log    airLogConfig   `toml:"log"`
+}
+
+type airBuildConfig struct {
+	Cmd          string   `toml:"cmd"`
+	Bin          string   `toml:"bin"`
+	ArgsBin      []string `toml:"args_bin"`
+	Delay        int      `toml:"delay"`
+	KillDelay    any      `toml:"kill_delay"`
+	IncludeExt   []string `toml:"include_ext"`
+	IncludeDir   []string `toml:"include_dir"`
+	IncludeFile  []string `toml:"include_file"`
+	ExcludeDir   []string `toml:"exclude_dir"`
+	ExcludeFile  []string `toml:"exclude_file"`
+	Poll         bool     `toml:"poll"`
+	PollInterval int      `toml:"poll_interval"`
+	// ExcludeUnchanged is a pointer so that an omitted key keeps goreload's default.
+	ExcludeUnchanged *bool `toml:"exclude_unchanged"`
+}
+
+type airLogConfig struct {
+	Time bool `toml:"time"`
+}
+
+// airSupported lists the air keys that FromAir translates.
+var airSupported = map[string]bool{
+	"root":                    true,
+	"tmp_dir":                 true,
+	"build.cmd":               true,
+	"build.bin":               true,
+	"build.args_bin":          true,
+	"build.delay":             true,
+	"build.kill_delay":        true,
+	"build.include_ext":       true,
+	"build.include_dir":       true,
+	"build.include_file":      true,
+	"build.exclude_dir":       true,
+	"build.exclude_file":      true,
+	"build.poll":              true,
+	"build.poll_interval":     true,
+	"build.exclude_unchanged": true,
+	"log.time":                true,
+}
+
+// Migration is another tool's configuration translated for goreload.
+type Migration struct {
+	Config *Config
+	// Keys are the goreload options the source file set, as dotted paths
+	// such as "build.cmd". The other options of Config are defaults.
+	Keys []string
+	// Warnings name every source option that has no goreload equivalent.
+	Warnings []string
+}
+
+// FromAir translates an air configuration file into a goreload Config.
+func FromAir(path string) (*Migration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read air config: %w", err)
+	}
+
+	var air airConfig
+	md, err := toml.Decode(string(data), &air)
+	if err != nil {
+		return nil, fmt.Errorf("parse air config: %w", err)
+	}
+
+	m := &Migration{Config: Default()}
+	for _, key := range md.Keys() {
+		name := key.String()
+		if md.Type(key...) == "Hash" || airSupported[name] {
+			continue
+		}
+		m.Warnings = append(m.Warnings, fmt.Sprintf("%s is not supported and was ignored", name))
+	}
+
+	cfg := m.Config
+	set := func(key string) { m.Keys = append(m.Keys, key) }
+
+	if air.Root != "" {
+		cfg.Root = air.Root
+		set("root")
+	}
+	if air.TmpDir != "" {
+		cfg.TmpDir = air.TmpDir
+		set("tmp_dir")
+	}
+
+	b := air.Build
+	if b.Cmd != "" {
+		cfg.Build.Cmd = b.Cmd
+		set("build.cmd")
+	}
+	if b.Bin != "" {
+		cfg.Build.Bin = b.Bin
+		set("build.bin")
+	}
+	if len(b.ArgsBin) > 0 {
+		cfg.Build.Args = b.ArgsBin
+		set("build.args")
+	}
+	if md.IsDefined("build", "delay") {
+		cfg.Build.Delay = time.Duration(b.Delay) * time.Millisecond
+		set("build.delay")
+	}
+	if b.KillDelay != nil {
+		d, err := airDuration(b.KillDelay)
+		if err != nil {
+			return nil, fmt.Errorf("parse build.kill_delay: %w", err)
+		}
+		cfg.Build.KillDelay = d
+		set("build.kill_delay")
+	}
+
+	if len(b.IncludeExt) > 0 {
+		cfg.Watch.Extensions = nil
+		for _, ext := range b.IncludeExt {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			cfg.Watch.Extensions = append(cfg.Watch.Extensions, ext)
+		}
+		set("watch.extensions")
+	}
+	if len(b.IncludeDir) > 0 {
+		cfg.Watch.Dirs = b.IncludeDir
+		set("watch.dirs")
+	}
+	if len(b.IncludeFile) > 0 {
+		cfg.Watch.Files = b.IncludeFile
+		set("watch.files")
+	}
+	if len(b.ExcludeDir) > 0 {
+		cfg.Watch.ExcludeDirs = b.ExcludeDir
+		set("watch.exclude_dirs")
+	}
+	if len(b.ExcludeFile) > 0 {
+		cfg.Watch.ExcludeFiles = b.ExcludeFile
+		set("watch.exclude_files")
+	}
+	if b.ExcludeUnchanged != nil {
+		cfg.Watch.IgnoreUnchanged = *b.ExcludeUnchanged
+		set("watch.ignore_unchanged")
+	}
+
+	if b.Poll {
+		cfg.Watch.Backend = "poll"
+		set("watch.backend")
+	}
+	if b.PollInterval > 0 {
+		cfg.Watch.PollInterval = time.Duration(b.PollInterval) * time.Millisecond
+		set("watch.poll_interval")
+	}
+
+	if md.IsDefined("log", "time") {
+		cfg.Log.Time = air.Log.Time
+		set("log.time")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate config: %w", err)
+	}
+
+	return m, nil
+}
+
+// airDuration parses air's kill_delay, which is either a duration string or
+// an integer number of nanoseconds.
+func airDuration(v any) (time.Duration, error) {
+	switch d := v.(type) {
+	case string:
+		return time.ParseDuration(d)
+	case int64:
+		return time.Duration(d), nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromAir(t *testing.T) {
+	tmpDir := t.TempDir()
+	airPath := filepath.Join(tmpDir, DefaultAirConfigFile)
+	content := `
+root = "."
+tmp_dir = "tmp"
+
+[build]
+  cmd = "go build -o ./tmp/api ./cmd/api"
+  bin = "./tmp/api"
+  args_bin = ["-port", "8080"]
+  delay = 1000
+  kill_delay = "2s"
+  include_ext = ["go", "tpl"]
+  include_file = ["config/app.toml"]
+  exclude_dir = ["assets", "tmp"]
+  exclude_regex = ["_test.go"]
+  pre_cmd = ["echo hi"]
+  poll = true
+  poll_interval = 2000
+
+[log]
+  time = false
+
+[screen]
+  clear_on_rebuild = true
+`
+	if err := os.WriteFile(airPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write air config: %v", err)
+	}
+
+	m, err := FromAir(airPath)
+	if err != nil {
+		t.Fatalf("FromAir() error = %v", err)
+	}
+	cfg, warnings := m.Config, m.Warnings
+
+	if cfg.Build.Cmd != "go build -o ./tmp/api ./cmd/api" {
+		t.Errorf("Build.Cmd = %v", cfg.Build.Cmd)
+	}
+	if cfg.Build.Bin != "./tmp/api" {
+		t.Errorf("Build.Bin = %v", cfg.Build.Bin)
+	}
+	if !slices.Equal(cfg.Build.Args, []string{"-port", "8080"}) {
+		t.Errorf("Build.Args = %v", cfg.Build.Args)
+	}
+	if cfg.Build.Delay != time.Second {
+		t.Errorf("Build.Delay = %v, want 1s", cfg.Build.Delay)
+	}
+	if cfg.Build.KillDelay != 2*time.Second {
+		t.Errorf("Build.KillDelay = %v, want 2s", cfg.Build.KillDelay)
+	}
+	if !slices.Equal(cfg.Watch.Extensions, []string{".go", ".tpl"}) {
+		t.Errorf("Watch.Extensions = %v", cfg.Watch.Extensions)
+	}
+	if !slices.Equal(cfg.Watch.Files, []string{"config/app.toml"}) {
+		t.Errorf("Watch.Files = %v", cfg.Watch.Files)
+	}
+	if !slices.Equal(cfg.Watch.ExcludeDirs, []string{"assets", "tmp"}) {
+		t.Errorf("Watch.ExcludeDirs = %v", cfg.Watch.ExcludeDirs)
+	}
+	if cfg.Watch.Backend != "poll" || cfg.Watch.PollInterval != 2*time.Second {
+		t.Errorf("Watch.Backend = %v, PollInterval = %v, want poll every 2s", cfg.Watch.Backend, cfg.Watch.PollInterval)
+	}
+	if cfg.Log.Time {
+		t.Error("Log.Time = true, want false")
+	}
+
+	for _, key := range []string{"build.exclude_regex", "build.pre_cmd", "screen.clear_on_rebuild"} {
+		if !slices.ContainsFunc(warnings, func(w string) bool { return strings.HasPrefix(w, key+" ") }) {
+			t.Errorf("warnings = %v, want a warning for %s", warnings, key)
+		}
+	}
+	if len(warnings) != 3 {
+		t.Errorf("warnings = %v, want 3", warnings)
+	}
+
+	// The migrated config must load back unchanged, and only hold the
+	// options the air file set.
+	outPath := filepath.Join(tmpDir, DefaultConfigFile)
+	if err := Write(outPath, cfg, "# migrated", m.Keys...); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	loaded, err := LoadWithDefaults(outPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() error = %v", err)
+	}
+	if loaded.Build.Delay != cfg.Build.Delay || !slices.Equal(loaded.Watch.Extensions, cfg.Watch.Extensions) {
+		t.Errorf("LoadWithDefaults() = %+v, want %+v", loaded, cfg)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("read migrated config: %v", err)
+	}
+	for _, key := range []string{"cmd:", "kill_delay:", "poll_interval:"} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("migrated config lacks %s:\n%s", key, data)
+		}
+	}
+	for _, key := range []string{"run:", "debounce:", "scope:", "level:", "exclude_files:"} {
+		if strings.Contains(string(data), key) {
+			t.Errorf("migrated config has %s, which the air file did not set:\n%s", key, data)
+		}
+	}
+
+	t.Run("zero kill delay", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "zero.toml")
+		if err := os.WriteFile(path, []byte("[build]\n  kill_delay = \"0s\"\n"), 0644); err != nil {
+			t.Fatalf("write air config: %v", err)
+		}
+		m, err := FromAir(path)
+		if err != nil {
+			t.Fatalf("FromAir() error = %v", err)
+		}
+		if m.Config.Build.KillDelay != 0 || !slices.Equal(m.Keys, []string{"build.kill_delay"}) {
+			t.Errorf("FromAir() KillDelay = %v, Keys = %v, want 0 and set", m.Config.Build.KillDelay, m.Keys)
+		}
+	})
+}
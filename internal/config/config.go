@@ -6,20 +6,52 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 // Default configuration values.
 const (
-	DefaultTmpDir     = "tmp"
-	DefaultBuildCmd   = "go build -o ./tmp/main ."
-	DefaultBin        = "./tmp/main"
-	DefaultDelay      = 200 * time.Millisecond
-	DefaultKillDelay  = 500 * time.Millisecond
-	DefaultLogLevel   = "info"
-	DefaultConfigFile = "goreload.yaml"
+	DefaultTmpDir       = "tmp"
+	DefaultBuildCmd     = "go build -o ./tmp/main ."
+	DefaultBin          = "./tmp/main"
+	DefaultDelay        = 200 * time.Millisecond
+	DefaultKillDelay    = 500 * time.Millisecond
+	DefaultLogLevel     = "info"
+	DefaultBackend      = "fsnotify"
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultConfigFile   = "goreload.yaml"
 )
 
+// Watch scopes.
+const (
+	// ScopeAll watches the configured directories recursively.
+	ScopeAll = "all"
+	// ScopeDeps watches only the directories of the packages the build
+	// target depends on.
+	ScopeDeps = "deps"
+)
+
+// Debounce modes.
+const (
+	// DebounceTrailing rebuilds once no change has arrived for the delay.
+	DebounceTrailing = "trailing"
+	// DebounceLeading rebuilds on the first change and then at most once
+	// per delay while changes keep arriving.
+	DebounceLeading = "leading"
+)
+
+// ConfigFiles are the file names searched for a configuration, in order of
+// precedence, when no config file is given explicitly.
+var ConfigFiles = []string{DefaultConfigFile, "goreload.yml", "goreload.toml", "goreload.json"}
+
+// ProfileEnv is the environment variable used to select a profile when no
+// --profile flag is given.
+const ProfileEnv = "GORELOAD_PROFILE"
+
 // Sentinel errors for configuration validation.
 var (
 	ErrEmptyBuildCmd    = errors.New("build command cannot be empty")
@@ -29,6 +61,17 @@ var (
 	ErrInvalidLogLevel  = errors.New("log level must be one of: debug, info, warn, error")
 	ErrNoExtensions     = errors.New("at least one file extension must be specified")
 	ErrNoDirs           = errors.New("at least one watch directory must be specified")
+	ErrInvalidBackend   = errors.New("backend must be one of: fsnotify, poll, auto")
+	ErrInvalidPoll      = errors.New("poll_interval must be positive")
+	ErrUnknownProfile   = errors.New("unknown profile")
+	ErrExtendsCycle     = errors.New("extends cycle")
+	ErrInvalidIgnoreOp  = errors.New("ignore_ops must only contain: create, write, remove, rename, chmod")
+	ErrInvalidScope     = errors.New("scope must be one of: all, deps")
+	ErrInvalidDebounce  = errors.New("debounce mode must be one of: trailing, leading")
+	ErrInvalidDuration  = errors.New("debounce durations must be positive")
+	ErrInvalidRestart   = errors.New("min_restart_interval must be positive")
+	ErrInvalidRestarts  = errors.New("max_restarts_per_minute must be positive")
+	ErrInvalidPattern   = errors.New("invalid glob pattern")
 )
 
 // Config represents the complete goreload configuration.
@@ -37,7 +80,17 @@ type Config struct {
 	TmpDir string      `yaml:"tmp_dir"`
 	Build  BuildConfig `yaml:"build"`
 	Watch  WatchConfig `yaml:"watch"`
+	Run    RunConfig   `yaml:"run"`
 	Log    LogConfig   `yaml:"log"`
+
+	// Path is the absolute path of the file this configuration was loaded
+	// from. It is empty for the built-in defaults.
+	Path string `yaml:"-"`
+	// Files lists every file merged into this configuration: the files
+	// reached through "extends" followed by Path itself.
+	Files []string `yaml:"-"`
+	// Profile is the name of the profile overlaid on this configuration, if any.
+	Profile string `yaml:"-"`
 }
 
 // BuildConfig holds build-related settings.
@@ -55,6 +108,89 @@ type WatchConfig struct {
 	Dirs         []string `yaml:"dirs"`
 	ExcludeDirs  []string `yaml:"exclude_dirs"`
 	ExcludeFiles []string `yaml:"exclude_files"`
+	// Include and Exclude are "**" glob patterns matched against
+	// root-relative paths. A leading "!" negates a pattern.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// Files are individual files to watch, relative to Root, whether or
+	// not they are inside Dirs and whatever their extension.
+	Files []string `yaml:"files"`
+	// Names are file name patterns, such as "Makefile" or "*.env", matched
+	// against the base name of files in Dirs in addition to Extensions.
+	Names []string `yaml:"names"`
+	// GitIgnore applies .gitignore files and .git/info/exclude to the
+	// watched tree. .goreloadignore files are always applied.
+	GitIgnore bool `yaml:"gitignore"`
+	// Backend is the change detection mechanism: fsnotify, poll or auto.
+	// An empty value means fsnotify.
+	Backend      string        `yaml:"backend"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	PollHash     bool          `yaml:"poll_hash"`
+	// PollOverflow polls the directories beyond the system limit on
+	// watches instead of failing to start.
+	PollOverflow bool `yaml:"poll_overflow"`
+	// IgnoreUnchanged drops events after which a file's content is the same
+	// as before, such as touches and identical rewrites.
+	IgnoreUnchanged bool `yaml:"ignore_unchanged"`
+	// IgnoreOps lists operations that never trigger a rebuild: create,
+	// write, remove, rename or chmod.
+	IgnoreOps []string `yaml:"ignore_ops"`
+	// IgnoreEditorFiles drops events for editor backup, swap and temporary
+	// files such as "main.go~", ".main.go.swp" and "main.go___jb_tmp___".
+	IgnoreEditorFiles bool `yaml:"ignore_editor_files"`
+	// LocalModules also watches the modules that go.mod replace directives
+	// and go.work point to on the local file system.
+	LocalModules bool `yaml:"local_modules"`
+	// Scope selects what is watched: "all" for Dirs, or "deps" for the
+	// directories of the packages the build target depends on. An empty
+	// value means "all".
+	Scope string `yaml:"scope"`
+	// Embeds also watches the files that the packages of a "go build"
+	// command embed with //go:embed, whatever their extension.
+	Embeds bool `yaml:"embeds"`
+	// BuildConstraints ignores changes to Go files that //go:build lines or
+	// _GOOS and _GOARCH file name suffixes exclude from the build, for the
+	// go command's GOOS, GOARCH and the -tags of a "go build" command.
+	BuildConstraints bool `yaml:"build_constraints"`
+	// FollowSymlinks watches the directories that symbolic links in the
+	// watched tree point to.
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+	// Git holds rebuilds while a git checkout, rebase or merge rewrites the
+	// working tree, and logs the new branch and commit when HEAD moves.
+	Git bool `yaml:"git"`
+	// Debounce controls how changes are batched into rebuilds.
+	Debounce DebounceConfig `yaml:"debounce"`
+}
+
+// DebounceConfig holds the timing of change batching. The watcher settings
+// decide when a batch of changes is delivered; Throttle paces the rebuilds
+// and restarts that follow.
+type DebounceConfig struct {
+	// Mode is DebounceTrailing or DebounceLeading. An empty value means
+	// DebounceTrailing.
+	Mode string `yaml:"mode"`
+	// Delay is the debounce window of the watcher. Zero means build.delay.
+	Delay time.Duration `yaml:"delay"`
+	// MaxWait caps how long a stream of changes can postpone a rebuild in
+	// trailing mode. Zero means no cap.
+	MaxWait time.Duration `yaml:"max_wait"`
+	// Adaptive stretches the delay up to four times while changes arrive in
+	// bursts, and keeps rebuilds at least as far apart as the last build took.
+	Adaptive bool `yaml:"adaptive"`
+	// Throttle is the minimum time between the end of one build and the
+	// start of the next.
+	Throttle time.Duration `yaml:"throttle"`
+}
+
+// RunConfig holds limits on restarting the application. When a limit is
+// hit, rebuilds pause until the next change.
+type RunConfig struct {
+	// MinRestartInterval is the shortest time allowed between two restarts.
+	// Zero means no limit.
+	MinRestartInterval time.Duration `yaml:"min_restart_interval"`
+	// MaxRestartsPerMinute is the most restarts allowed within a minute.
+	// Zero means no limit.
+	MaxRestartsPerMinute int `yaml:"max_restarts_per_minute"`
 }
 
 // LogConfig holds logging settings.
@@ -72,6 +208,9 @@ func (c *Config) Validate() error {
 	if err := c.Watch.validate(); err != nil {
 		return fmt.Errorf("watch config: %w", err)
 	}
+	if err := c.Run.validate(); err != nil {
+		return fmt.Errorf("run config: %w", err)
+	}
 	if err := c.Log.validate(); err != nil {
 		return fmt.Errorf("log config: %w", err)
 	}
@@ -101,6 +240,64 @@ func (w *WatchConfig) validate() error {
 	if len(w.Dirs) == 0 {
 		return ErrNoDirs
 	}
+	switch w.Backend {
+	case "", "fsnotify", "poll", "auto":
+	default:
+		return ErrInvalidBackend
+	}
+	if w.PollInterval < 0 {
+		return ErrInvalidPoll
+	}
+	switch w.Scope {
+	case "", ScopeAll, ScopeDeps:
+	default:
+		return ErrInvalidScope
+	}
+	if err := w.Debounce.validate(); err != nil {
+		return err
+	}
+	for _, p := range append(slices.Clip(w.Include), w.Exclude...) {
+		if !validPattern(p) {
+			return fmt.Errorf("%w: %q", ErrInvalidPattern, p)
+		}
+	}
+	for _, op := range w.IgnoreOps {
+		switch strings.ToLower(op) {
+		case "create", "write", "remove", "rename", "chmod":
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidIgnoreOp, op)
+		}
+	}
+	return nil
+}
+
+// validPattern reports whether p is a usable include or exclude pattern: a
+// "**" glob, optionally negated with "!", that is not empty.
+func validPattern(p string) bool {
+	p = strings.TrimPrefix(p, "!")
+	p = strings.TrimSuffix(strings.TrimPrefix(p, "/"), "/")
+	return p != "" && doublestar.ValidatePattern(p)
+}
+
+func (d *DebounceConfig) validate() error {
+	switch d.Mode {
+	case "", DebounceTrailing, DebounceLeading:
+	default:
+		return ErrInvalidDebounce
+	}
+	if d.Delay < 0 || d.MaxWait < 0 || d.Throttle < 0 {
+		return ErrInvalidDuration
+	}
+	return nil
+}
+
+func (r *RunConfig) validate() error {
+	if r.MinRestartInterval < 0 {
+		return ErrInvalidRestart
+	}
+	if r.MaxRestartsPerMinute < 0 {
+		return ErrInvalidRestarts
+	}
 	return nil
 }
 
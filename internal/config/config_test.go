@@ -79,6 +79,78 @@ func TestConfig_Validate(t *testing.T) {
 			}(),
 			wantErr: ErrInvalidLogLevel,
 		},
+		{
+			name: "invalid ignore op",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.IgnoreOps = []string{"chmod", "touch"}
+				return c
+			}(),
+			wantErr: ErrInvalidIgnoreOp,
+		},
+		{
+			name: "invalid include pattern",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.Include = []string{"**/*.go", "web/[a-"}
+				return c
+			}(),
+			wantErr: ErrInvalidPattern,
+		},
+		{
+			name: "empty exclude pattern",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.Exclude = []string{"!"}
+				return c
+			}(),
+			wantErr: ErrInvalidPattern,
+		},
+		{
+			name: "invalid scope",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.Scope = "packages"
+				return c
+			}(),
+			wantErr: ErrInvalidScope,
+		},
+		{
+			name: "invalid debounce mode",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.Debounce.Mode = "both"
+				return c
+			}(),
+			wantErr: ErrInvalidDebounce,
+		},
+		{
+			name: "negative max_wait",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Watch.Debounce.MaxWait = -time.Second
+				return c
+			}(),
+			wantErr: ErrInvalidDuration,
+		},
+		{
+			name: "negative min_restart_interval",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Run.MinRestartInterval = -time.Second
+				return c
+			}(),
+			wantErr: ErrInvalidRestart,
+		},
+		{
+			name: "negative max_restarts_per_minute",
+			cfg: func() Config {
+				c := *validConfig()
+				c.Run.MaxRestartsPerMinute = -1
+				return c
+			}(),
+			wantErr: ErrInvalidRestarts,
+		},
 	}
 
 	for _, tt := range tests {
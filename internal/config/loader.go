@@ -1,28 +1,151 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
 )
 
 // rawConfig is used for YAML unmarshaling with string durations.
 type rawConfig struct {
-	Root   string         `yaml:"root"`
-	TmpDir string         `yaml:"tmp_dir"`
-	Build  rawBuildConfig `yaml:"build"`
-	Watch  WatchConfig    `yaml:"watch"`
-	Log    LogConfig      `yaml:"log"`
+	Extends  stringList           `yaml:"extends"`
+	Root     string               `yaml:"root"`
+	TmpDir   string               `yaml:"tmp_dir"`
+	Build    rawBuildConfig       `yaml:"build"`
+	Watch    rawWatchConfig       `yaml:"watch"`
+	Run      rawRunConfig         `yaml:"run"`
+	Log      rawLogConfig         `yaml:"log"`
+	Profiles map[string]rawConfig `yaml:"profiles"`
 }
 
 type rawBuildConfig struct {
-	Cmd       string   `yaml:"cmd"`
-	Bin       string   `yaml:"bin"`
-	Args      []string `yaml:"args"`
-	Delay     string   `yaml:"delay"`
-	KillDelay string   `yaml:"kill_delay"`
+	Cmd       string    `yaml:"cmd"`
+	Bin       string    `yaml:"bin"`
+	Args      listValue `yaml:"args"`
+	Delay     string    `yaml:"delay"`
+	KillDelay string    `yaml:"kill_delay"`
+}
+
+type rawWatchConfig struct {
+	Extensions   listValue `yaml:"extensions"`
+	Dirs         listValue `yaml:"dirs"`
+	ExcludeDirs  listValue `yaml:"exclude_dirs"`
+	ExcludeFiles listValue `yaml:"exclude_files"`
+	Include      listValue `yaml:"include"`
+	Exclude      listValue `yaml:"exclude"`
+	Files        listValue `yaml:"files"`
+	Names        listValue `yaml:"names"`
+	GitIgnore    *bool     `yaml:"gitignore"`
+	Backend      string    `yaml:"backend"`
+	PollInterval string    `yaml:"poll_interval"`
+	PollHash     *bool     `yaml:"poll_hash"`
+	PollOverflow *bool     `yaml:"poll_overflow"`
+	// IgnoreUnchanged defaults to true, so an omitted value must be told
+	// apart from false.
+	IgnoreUnchanged   *bool     `yaml:"ignore_unchanged"`
+	IgnoreOps         listValue `yaml:"ignore_ops"`
+	IgnoreEditorFiles *bool     `yaml:"ignore_editor_files"`
+	LocalModules      *bool     `yaml:"local_modules"`
+	Scope             string    `yaml:"scope"`
+	Embeds            *bool     `yaml:"embeds"`
+	BuildConstraints  *bool     `yaml:"build_constraints"`
+	FollowSymlinks    *bool     `yaml:"follow_symlinks"`
+	Git               *bool     `yaml:"git"`
+
+	Debounce rawDebounceConfig `yaml:"debounce"`
+}
+
+type rawDebounceConfig struct {
+	Mode     string `yaml:"mode"`
+	Delay    string `yaml:"delay"`
+	MaxWait  string `yaml:"max_wait"`
+	Adaptive *bool  `yaml:"adaptive"`
+	Throttle string `yaml:"throttle"`
+}
+
+// rawRunConfig uses a pointer so that an explicit 0 can turn off the
+// default limit.
+type rawRunConfig struct {
+	MinRestartInterval   string `yaml:"min_restart_interval"`
+	MaxRestartsPerMinute *int   `yaml:"max_restarts_per_minute"`
+}
+
+// rawLogConfig uses pointers so that an omitted boolean can be told apart
+// from an explicit false when overlaying profiles.
+type rawLogConfig struct {
+	Color *bool  `yaml:"color"`
+	Time  *bool  `yaml:"time"`
+	Level string `yaml:"level"`
+}
+
+// stringList accepts either a single string or a sequence of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var s string
+		if err := node.Decode(&s); err != nil {
+			return err
+		}
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// listValue is a list option that replaces the inherited value when written
+// as a sequence, or extends it when written as a mapping with an "append" key:
+//
+//	exclude_dirs:
+//	  append: ["dist"]
+type listValue struct {
+	Items  []string
+	Append bool
+}
+
+func (l *listValue) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		var m struct {
+			Append []string `yaml:"append"`
+		}
+		if err := node.Decode(&m); err != nil {
+			return err
+		}
+		l.Items = m.Append
+		l.Append = true
+		return nil
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil
+		}
+		return fmt.Errorf("line %d: expected a list or an append mapping", node.Line)
+	default:
+		return node.Decode(&l.Items)
+	}
+}
+
+// mergeInto applies the list to an inherited value.
+func (l *listValue) mergeInto(dst *[]string) {
+	switch {
+	case l.Append:
+		*dst = append(slices.Clone(*dst), l.Items...)
+	case len(l.Items) > 0:
+		*dst = l.Items
+	}
 }
 
 // Default returns a Config with default values.
@@ -38,10 +161,25 @@ func Default() *Config {
 			KillDelay: DefaultKillDelay,
 		},
 		Watch: WatchConfig{
-			Extensions:   []string{".go"},
-			Dirs:         []string{"."},
-			ExcludeDirs:  []string{"tmp", "vendor", ".git", "node_modules"},
-			ExcludeFiles: []string{},
+			Extensions:        []string{".go"},
+			Dirs:              []string{"."},
+			ExcludeDirs:       []string{"tmp", "vendor", ".git", "node_modules"},
+			ExcludeFiles:      []string{},
+			Files:             []string{},
+			Names:             []string{},
+			Backend:           DefaultBackend,
+			PollInterval:      DefaultPollInterval,
+			IgnoreUnchanged:   true,
+			IgnoreOps:         []string{},
+			IgnoreEditorFiles: true,
+			LocalModules:      true,
+			Scope:             ScopeAll,
+			Embeds:            true,
+			BuildConstraints:  true,
+			Git:               true,
+			Debounce: DebounceConfig{
+				Mode: DebounceTrailing,
+			},
 		},
 		Log: LogConfig{
 			Color: true,
@@ -51,31 +189,159 @@ func Default() *Config {
 	}
 }
 
-// LoadWithDefaults reads a YAML configuration file and merges it with default values.
+// LoadWithDefaults reads a configuration file and merges it with default values.
+// The format (YAML, TOML or JSON) is chosen from the file extension.
 func LoadWithDefaults(path string) (*Config, error) {
-	cfg := Default()
+	return LoadProfile(path, "")
+}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read config file: %w", err)
+// LoadProfile reads a configuration file, merges it with default values
+// and then overlays the named profile on top. An empty profile name loads the
+// base configuration only.
+//
+// Files listed under "extends" are merged first, in order, so the declaring
+// file takes precedence over the files it extends.
+func LoadProfile(path, profile string) (*Config, error) {
+	l := &loader{
+		cfg:      Default(),
+		profiles: make(map[string]rawConfig),
 	}
 
-	var raw rawConfig
-	if err := yaml.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("parse config file: %w", err)
+	if err := l.load(path, nil); err != nil {
+		return nil, err
 	}
+	cfg := l.cfg
 
-	if err := mergeConfig(cfg, &raw); err != nil {
-		return nil, fmt.Errorf("merge config: %w", err)
+	if profile != "" {
+		overlay, ok := l.profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, profile)
+		}
+		if err := mergeConfig(cfg, &overlay); err != nil {
+			return nil, fmt.Errorf("merge profile %s: %w", profile, err)
+		}
+		cfg.Profile = profile
 	}
 
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("validate config: %w", err)
 	}
 
+	cfg.Path = l.files[len(l.files)-1]
+	cfg.Files = l.files
+
 	return cfg, nil
 }
 
+// loader merges a config file and the files it extends into a Config.
+type loader struct {
+	cfg      *Config
+	profiles map[string]rawConfig
+	// files lists every file loaded, bases before the files extending them.
+	files []string
+}
+
+func (l *loader) load(path string, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve config path: %w", err)
+	}
+	if slices.Contains(stack, abs) {
+		return fmt.Errorf("%w: %s", ErrExtendsCycle, strings.Join(append(stack, abs), " -> "))
+	}
+	// A base reached twice, such as a shared base in a diamond, is merged
+	// once, where it was first reached.
+	if slices.Contains(l.files, abs) {
+		return nil
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var raw rawConfig
+	if err := decode(abs, data, &raw); err != nil {
+		return fmt.Errorf("parse config file: %w", err)
+	}
+
+	// Paths in extended files are relative to the file declaring them.
+	dir := filepath.Dir(abs)
+	for _, base := range raw.Extends {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(dir, base)
+		}
+		if err := l.load(base, append(stack, abs)); err != nil {
+			return fmt.Errorf("extends %s: %w", base, err)
+		}
+	}
+	if len(stack) > 0 {
+		raw.rebase(dir)
+	}
+
+	if err := mergeConfig(l.cfg, &raw); err != nil {
+		return fmt.Errorf("merge config: %w", err)
+	}
+	for name, p := range raw.Profiles {
+		l.profiles[name] = p
+	}
+	l.files = append(l.files, abs)
+
+	return nil
+}
+
+// decode parses a config file in the format given by its extension. TOML and
+// JSON documents are converted to YAML first so that all formats share the
+// same schema and list semantics.
+func decode(path string, data []byte, raw *rawConfig) error {
+	var doc map[string]any
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+	default:
+		return yaml.Unmarshal(data, raw)
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, raw)
+}
+
+// rebase makes the relative paths of an extended file, and of its profiles,
+// relative to dir, the directory of that file. Paths in the file goreload was
+// started with stay relative to the working directory.
+func (raw *rawConfig) rebase(dir string) {
+	raw.Root = rebasePath(dir, raw.Root)
+	raw.TmpDir = rebasePath(dir, raw.TmpDir)
+	for i, d := range raw.Watch.Dirs.Items {
+		raw.Watch.Dirs.Items[i] = rebasePath(dir, d)
+	}
+	for i, f := range raw.Watch.Files.Items {
+		raw.Watch.Files.Items[i] = rebasePath(dir, f)
+	}
+	for name, p := range raw.Profiles {
+		p.rebase(dir)
+		raw.Profiles[name] = p
+	}
+}
+
+// rebasePath joins a non-empty relative path to dir.
+func rebasePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
 func mergeConfig(cfg *Config, raw *rawConfig) error {
 	if raw.Root != "" {
 		cfg.Root = raw.Root
@@ -87,7 +353,12 @@ func mergeConfig(cfg *Config, raw *rawConfig) error {
 	if err := mergeBuildConfig(&cfg.Build, &raw.Build); err != nil {
 		return err
 	}
-	mergeWatchConfig(&cfg.Watch, &raw.Watch)
+	if err := mergeWatchConfig(&cfg.Watch, &raw.Watch); err != nil {
+		return err
+	}
+	if err := mergeRunConfig(&cfg.Run, &raw.Run); err != nil {
+		return err
+	}
 	mergeLogConfig(&cfg.Log, &raw.Log)
 
 	return nil
@@ -100,9 +371,7 @@ func mergeBuildConfig(cfg *BuildConfig, raw *rawBuildConfig) error {
 	if raw.Bin != "" {
 		cfg.Bin = raw.Bin
 	}
-	if len(raw.Args) > 0 {
-		cfg.Args = raw.Args
-	}
+	raw.Args.mergeInto(&cfg.Args)
 	if raw.Delay != "" {
 		d, err := time.ParseDuration(raw.Delay)
 		if err != nil {
@@ -120,34 +389,131 @@ func mergeBuildConfig(cfg *BuildConfig, raw *rawBuildConfig) error {
 	return nil
 }
 
-func mergeWatchConfig(cfg *WatchConfig, raw *WatchConfig) {
-	if len(raw.Extensions) > 0 {
-		cfg.Extensions = raw.Extensions
+func mergeWatchConfig(cfg *WatchConfig, raw *rawWatchConfig) error {
+	raw.Extensions.mergeInto(&cfg.Extensions)
+	raw.Dirs.mergeInto(&cfg.Dirs)
+	raw.ExcludeDirs.mergeInto(&cfg.ExcludeDirs)
+	raw.ExcludeFiles.mergeInto(&cfg.ExcludeFiles)
+	raw.Include.mergeInto(&cfg.Include)
+	raw.Exclude.mergeInto(&cfg.Exclude)
+	raw.Files.mergeInto(&cfg.Files)
+	raw.Names.mergeInto(&cfg.Names)
+	if raw.GitIgnore != nil {
+		cfg.GitIgnore = *raw.GitIgnore
+	}
+	if raw.Backend != "" {
+		cfg.Backend = raw.Backend
+	}
+	if raw.PollInterval != "" {
+		d, err := time.ParseDuration(raw.PollInterval)
+		if err != nil {
+			return fmt.Errorf("parse poll_interval: %w", err)
+		}
+		cfg.PollInterval = d
+	}
+	if raw.PollHash != nil {
+		cfg.PollHash = *raw.PollHash
+	}
+	if raw.PollOverflow != nil {
+		cfg.PollOverflow = *raw.PollOverflow
+	}
+	if raw.IgnoreUnchanged != nil {
+		cfg.IgnoreUnchanged = *raw.IgnoreUnchanged
+	}
+	raw.IgnoreOps.mergeInto(&cfg.IgnoreOps)
+	if raw.IgnoreEditorFiles != nil {
+		cfg.IgnoreEditorFiles = *raw.IgnoreEditorFiles
+	}
+	if raw.LocalModules != nil {
+		cfg.LocalModules = *raw.LocalModules
+	}
+	if raw.Scope != "" {
+		cfg.Scope = raw.Scope
+	}
+	if raw.Embeds != nil {
+		cfg.Embeds = *raw.Embeds
+	}
+	if raw.BuildConstraints != nil {
+		cfg.BuildConstraints = *raw.BuildConstraints
+	}
+	if raw.FollowSymlinks != nil {
+		cfg.FollowSymlinks = *raw.FollowSymlinks
+	}
+	if raw.Git != nil {
+		cfg.Git = *raw.Git
+	}
+	return mergeDebounceConfig(&cfg.Debounce, &raw.Debounce)
+}
+
+func mergeDebounceConfig(cfg *DebounceConfig, raw *rawDebounceConfig) error {
+	if raw.Mode != "" {
+		cfg.Mode = raw.Mode
+	}
+	if raw.Delay != "" {
+		d, err := time.ParseDuration(raw.Delay)
+		if err != nil {
+			return fmt.Errorf("parse debounce.delay: %w", err)
+		}
+		cfg.Delay = d
+	}
+	if raw.MaxWait != "" {
+		d, err := time.ParseDuration(raw.MaxWait)
+		if err != nil {
+			return fmt.Errorf("parse debounce.max_wait: %w", err)
+		}
+		cfg.MaxWait = d
+	}
+	if raw.Throttle != "" {
+		d, err := time.ParseDuration(raw.Throttle)
+		if err != nil {
+			return fmt.Errorf("parse debounce.throttle: %w", err)
+		}
+		cfg.Throttle = d
 	}
-	if len(raw.Dirs) > 0 {
-		cfg.Dirs = raw.Dirs
+	if raw.Adaptive != nil {
+		cfg.Adaptive = *raw.Adaptive
 	}
-	if len(raw.ExcludeDirs) > 0 {
-		cfg.ExcludeDirs = raw.ExcludeDirs
+	return nil
+}
+
+func mergeRunConfig(cfg *RunConfig, raw *rawRunConfig) error {
+	if raw.MinRestartInterval != "" {
+		d, err := time.ParseDuration(raw.MinRestartInterval)
+		if err != nil {
+			return fmt.Errorf("parse min_restart_interval: %w", err)
+		}
+		cfg.MinRestartInterval = d
 	}
-	if len(raw.ExcludeFiles) > 0 {
-		cfg.ExcludeFiles = raw.ExcludeFiles
+	if raw.MaxRestartsPerMinute != nil {
+		cfg.MaxRestartsPerMinute = *raw.MaxRestartsPerMinute
 	}
+	return nil
 }
 
-func mergeLogConfig(cfg *LogConfig, raw *LogConfig) {
-	// For boolean fields, we need a different approach since zero value is meaningful.
-	// The raw config will have the parsed values, so we always use them if the YAML had values.
-	// This is a limitation - we can't distinguish between "not set" and "set to false".
-	// For now, we assume the YAML values take precedence if the raw struct has non-default values.
-	// A more robust solution would use pointers, but that complicates the API.
-	cfg.Color = raw.Color
-	cfg.Time = raw.Time
+func mergeLogConfig(cfg *LogConfig, raw *rawLogConfig) {
+	if raw.Color != nil {
+		cfg.Color = *raw.Color
+	}
+	if raw.Time != nil {
+		cfg.Time = *raw.Time
+	}
 	if raw.Level != "" {
 		cfg.Level = raw.Level
 	}
 }
 
+// Find returns the first of ConfigFiles that exists in dir, or an empty string
+// if there is none.
+func Find(dir string) string {
+	for _, name := range ConfigFiles {
+		path := filepath.Join(dir, name)
+		if Exists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
 // Exists checks if a configuration file exists at the given path.
 func Exists(path string) bool {
 	_, err := os.Stat(path)
@@ -156,20 +522,36 @@ func Exists(path string) bool {
 
 // WriteDefault writes a default configuration file to the given path.
 func WriteDefault(path string) error {
-	content := `# goreload configuration file
+	return WriteInit(path, InitOptions{
+		BuildCmd: DefaultBuildCmd,
+		Bin:      DefaultBin,
+		TmpDir:   DefaultTmpDir,
+	})
+}
+
+// InitOptions holds the project-specific values of a generated configuration file.
+type InitOptions struct {
+	BuildCmd string
+	Bin      string
+	TmpDir   string
+}
+
+// WriteInit writes a commented configuration file using the given options.
+func WriteInit(path string, opts InitOptions) error {
+	content := fmt.Sprintf(`# goreload configuration file
 
 # Project root directory
 root: "."
 
 # Temporary directory for build artifacts
-tmp_dir: "tmp"
+tmp_dir: %q
 
 # Build settings
 build:
   # Build command
-  cmd: "go build -o ./tmp/main ."
+  cmd: %q
   # Binary to execute
-  bin: "./tmp/main"
+  bin: %q
   # Arguments to pass to the binary
   args: []
   # Delay before building after file change (debounce)
@@ -187,7 +569,7 @@ watch:
     - "."
   # Directories to exclude
   exclude_dirs:
-    - "tmp"
+    - %q
     - "vendor"
     - ".git"
     - "node_modules"
@@ -203,6 +585,57 @@ log:
   time: true
   # Log level: debug, info, warn, error
   level: "info"
-`
+`, opts.TmpDir, opts.BuildCmd, opts.Bin, opts.TmpDir)
 	return os.WriteFile(path, []byte(content), 0644)
 }
+
+// Write writes cfg to path as YAML. A non-empty header is written above the
+// configuration and should consist of comment lines. When keys are given,
+// only those options, named by dotted paths such as "build.cmd", are
+// written; the others keep their defaults when the file is loaded.
+func Write(path string, cfg *Config, header string, keys ...string) error {
+	var buf bytes.Buffer
+	if header != "" {
+		buf.WriteString(header + "\n\n")
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	if len(keys) > 0 {
+		pruneNode(&doc, "", keys)
+	}
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// pruneNode removes the entries of the mapping n that are neither one of
+// keys nor lead to one. prefix is the dotted path of n.
+func pruneNode(n *yaml.Node, prefix string, keys []string) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		path := prefix + k.Value
+		switch {
+		case slices.Contains(keys, path):
+		case v.Kind == yaml.MappingNode && slices.ContainsFunc(keys, func(key string) bool {
+			return strings.HasPrefix(key, path+".")
+		}):
+			pruneNode(v, path+".", keys)
+		default:
+			continue
+		}
+		content = append(content, k, v)
+	}
+	n.Content = content
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,6 +31,9 @@ func TestDefault(t *testing.T) {
 	if cfg.Build.KillDelay != DefaultKillDelay {
 		t.Errorf("Default().Build.KillDelay = %v, want %v", cfg.Build.KillDelay, DefaultKillDelay)
 	}
+	if cfg.Run.MaxRestartsPerMinute != 0 {
+		t.Errorf("Default().Run.MaxRestartsPerMinute = %v, want 0", cfg.Run.MaxRestartsPerMinute)
+	}
 	if cfg.Log.Level != DefaultLogLevel {
 		t.Errorf("Default().Log.Level = %v, want %v", cfg.Log.Level, DefaultLogLevel)
 	}
@@ -139,6 +145,141 @@ log:
 			t.Error("LoadWithDefaults() error = nil, want error for invalid duration")
 		}
 	})
+
+	t.Run("debounce", func(t *testing.T) {
+		configPath := filepath.Join(tmpDir, "debounce.yaml")
+		content := `
+watch:
+  debounce:
+    mode: leading
+    delay: 50ms
+    max_wait: 2s
+    adaptive: true
+    throttle: 1s
+`
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("write config file: %v", err)
+		}
+
+		cfg, err := LoadWithDefaults(configPath)
+		if err != nil {
+			t.Fatalf("LoadWithDefaults() error = %v", err)
+		}
+
+		want := DebounceConfig{
+			Mode:     DebounceLeading,
+			Delay:    50 * time.Millisecond,
+			MaxWait:  2 * time.Second,
+			Adaptive: true,
+			Throttle: time.Second,
+		}
+		if cfg.Watch.Debounce != want {
+			t.Errorf("Watch.Debounce = %+v, want %+v", cfg.Watch.Debounce, want)
+		}
+	})
+
+	t.Run("run limits", func(t *testing.T) {
+		configPath := filepath.Join(tmpDir, "run.yaml")
+		content := `
+run:
+  min_restart_interval: 500ms
+  max_restarts_per_minute: 0
+`
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("write config file: %v", err)
+		}
+
+		cfg, err := LoadWithDefaults(configPath)
+		if err != nil {
+			t.Fatalf("LoadWithDefaults() error = %v", err)
+		}
+
+		want := RunConfig{MinRestartInterval: 500 * time.Millisecond}
+		if cfg.Run != want {
+			t.Errorf("Run = %+v, want %+v", cfg.Run, want)
+		}
+	})
+
+	t.Run("invalid debounce duration", func(t *testing.T) {
+		configPath := filepath.Join(tmpDir, "invalid_debounce.yaml")
+		content := `
+watch:
+  debounce:
+    max_wait: forever
+`
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("write config file: %v", err)
+		}
+
+		_, err := LoadWithDefaults(configPath)
+		if err == nil || !strings.Contains(err.Error(), "debounce.max_wait") {
+			t.Errorf("LoadWithDefaults() error = %v, want a debounce.max_wait error", err)
+		}
+	})
+}
+
+func TestLoadProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+	content := `
+build:
+  cmd: "go build -o ./tmp/main ."
+  args: ["-port=8080"]
+log:
+  color: false
+profiles:
+  race:
+    build:
+      cmd: "go build -race -o ./tmp/main ."
+  debug:
+    log:
+      level: "debug"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	t.Run("base config", func(t *testing.T) {
+		cfg, err := LoadProfile(configPath, "")
+		if err != nil {
+			t.Fatalf("LoadProfile() error = %v", err)
+		}
+		if cfg.Build.Cmd != "go build -o ./tmp/main ." {
+			t.Errorf("Build.Cmd = %v", cfg.Build.Cmd)
+		}
+		if cfg.Profile != "" {
+			t.Errorf("Profile = %v, want empty", cfg.Profile)
+		}
+	})
+
+	t.Run("profile overlays base", func(t *testing.T) {
+		cfg, err := LoadProfile(configPath, "race")
+		if err != nil {
+			t.Fatalf("LoadProfile() error = %v", err)
+		}
+		if cfg.Build.Cmd != "go build -race -o ./tmp/main ." {
+			t.Errorf("Build.Cmd = %v", cfg.Build.Cmd)
+		}
+		if len(cfg.Build.Args) != 1 || cfg.Build.Args[0] != "-port=8080" {
+			t.Errorf("Build.Args = %v, want base args", cfg.Build.Args)
+		}
+		if cfg.Log.Color {
+			t.Error("Log.Color = true, want base value false")
+		}
+		if !cfg.Log.Time {
+			t.Error("Log.Time = false, want default true")
+		}
+		if cfg.Profile != "race" {
+			t.Errorf("Profile = %v, want race", cfg.Profile)
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := LoadProfile(configPath, "missing")
+		if !errors.Is(err, ErrUnknownProfile) {
+			t.Errorf("LoadProfile() error = %v, want %v", err, ErrUnknownProfile)
+		}
+	})
 }
 
 func TestExists(t *testing.T) {
@@ -180,3 +321,258 @@ func TestWriteDefault(t *testing.T) {
 		t.Error("Generated config has empty build command")
 	}
 }
+
+func TestLoadWithDefaults_Extends(t *testing.T) {
+	tmpDir := t.TempDir()
+	serviceDir := filepath.Join(tmpDir, "services", "api")
+	if err := os.MkdirAll(serviceDir, 0755); err != nil {
+		t.Fatalf("create service dir: %v", err)
+	}
+
+	base := `
+root: "."
+build:
+  delay: "300ms"
+watch:
+  exclude_dirs:
+    - "tmp"
+    - "vendor"
+profiles:
+  race:
+    build:
+      cmd: "go build -race -o ./tmp/main ."
+`
+	service := `
+extends: ../../base.yaml
+root: "."
+watch:
+  exclude_dirs:
+    append:
+      - "dist"
+`
+	basePath := filepath.Join(tmpDir, "base.yaml")
+	servicePath := filepath.Join(serviceDir, "goreload.yaml")
+	if err := os.WriteFile(basePath, []byte(base), 0644); err != nil {
+		t.Fatalf("write base config: %v", err)
+	}
+	if err := os.WriteFile(servicePath, []byte(service), 0644); err != nil {
+		t.Fatalf("write service config: %v", err)
+	}
+
+	cfg, err := LoadProfile(servicePath, "race")
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+
+	if cfg.Build.Delay != 300*time.Millisecond {
+		t.Errorf("Build.Delay = %v, want inherited 300ms", cfg.Build.Delay)
+	}
+	if cfg.Build.Cmd != "go build -race -o ./tmp/main ." {
+		t.Errorf("Build.Cmd = %v, want inherited profile", cfg.Build.Cmd)
+	}
+	wantExclude := []string{"tmp", "vendor", "dist"}
+	if !slices.Equal(cfg.Watch.ExcludeDirs, wantExclude) {
+		t.Errorf("Watch.ExcludeDirs = %v, want %v", cfg.Watch.ExcludeDirs, wantExclude)
+	}
+	if cfg.Root != "." {
+		t.Errorf("Root = %v, want . from the declaring file", cfg.Root)
+	}
+	if !slices.Equal(cfg.Files, []string{basePath, servicePath}) {
+		t.Errorf("Files = %v, want [%s %s]", cfg.Files, basePath, servicePath)
+	}
+
+	t.Run("paths relative to extended file", func(t *testing.T) {
+		pathBase := filepath.Join(tmpDir, "pathbase.yaml")
+		content := `
+root: "."
+tmp_dir: "build"
+watch:
+  dirs: ["src", "/abs"]
+  files:
+    append: ["config/app.env"]
+profiles:
+  other:
+    root: "./other"
+`
+		if err := os.WriteFile(pathBase, []byte(content), 0644); err != nil {
+			t.Fatalf("write base config: %v", err)
+		}
+		path := filepath.Join(serviceDir, "paths.yaml")
+		if err := os.WriteFile(path, []byte("extends: [../../pathbase.yaml]\n"), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		cfg, err := LoadProfile(path, "")
+		if err != nil {
+			t.Fatalf("LoadProfile() error = %v", err)
+		}
+		if cfg.Root != tmpDir {
+			t.Errorf("Root = %v, want %v", cfg.Root, tmpDir)
+		}
+		if want := filepath.Join(tmpDir, "build"); cfg.TmpDir != want {
+			t.Errorf("TmpDir = %v, want %v", cfg.TmpDir, want)
+		}
+		if want := []string{filepath.Join(tmpDir, "src"), "/abs"}; !slices.Equal(cfg.Watch.Dirs, want) {
+			t.Errorf("Watch.Dirs = %v, want %v", cfg.Watch.Dirs, want)
+		}
+		if want := []string{filepath.Join(tmpDir, "config", "app.env")}; !slices.Equal(cfg.Watch.Files, want) {
+			t.Errorf("Watch.Files = %v, want %v", cfg.Watch.Files, want)
+		}
+
+		cfg, err = LoadProfile(path, "other")
+		if err != nil {
+			t.Fatalf("LoadProfile(other) error = %v", err)
+		}
+		if want := filepath.Join(tmpDir, "other"); cfg.Root != want {
+			t.Errorf("LoadProfile(other) Root = %v, want %v", cfg.Root, want)
+		}
+	})
+
+	t.Run("diamond", func(t *testing.T) {
+		files := map[string]string{
+			"shared.yaml":  "build:\n  delay: \"100ms\"\n",
+			"left.yaml":    "extends: shared.yaml\nbuild:\n  delay: \"200ms\"\n",
+			"right.yaml":   "extends: shared.yaml\n",
+			"diamond.yaml": "extends: [left.yaml, right.yaml]\n",
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+		}
+
+		cfg, err := LoadWithDefaults(filepath.Join(tmpDir, "diamond.yaml"))
+		if err != nil {
+			t.Fatalf("LoadWithDefaults() error = %v", err)
+		}
+		// The shared base is not merged again over left.yaml.
+		if cfg.Build.Delay != 200*time.Millisecond {
+			t.Errorf("Build.Delay = %v, want 200ms from left.yaml", cfg.Build.Delay)
+		}
+		var want []string
+		for _, name := range []string{"shared.yaml", "left.yaml", "right.yaml", "diamond.yaml"} {
+			want = append(want, filepath.Join(tmpDir, name))
+		}
+		if !slices.Equal(cfg.Files, want) {
+			t.Errorf("Files = %v, want %v", cfg.Files, want)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a := filepath.Join(tmpDir, "a.yaml")
+		b := filepath.Join(tmpDir, "b.yaml")
+		if err := os.WriteFile(a, []byte("extends: b.yaml\n"), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		if err := os.WriteFile(b, []byte("extends: a.yaml\n"), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		_, err := LoadWithDefaults(a)
+		if !errors.Is(err, ErrExtendsCycle) {
+			t.Errorf("LoadWithDefaults() error = %v, want %v", err, ErrExtendsCycle)
+		}
+	})
+}
+
+func TestLoadWithDefaults_Formats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "goreload.toml",
+			content: `
+[build]
+cmd = "go build -o ./tmp/app ./cmd/app"
+delay = "300ms"
+
+[watch]
+exclude_dirs = { append = ["dist"] }
+`,
+		},
+		{
+			name: "goreload.json",
+			content: `{
+  "build": {"cmd": "go build -o ./tmp/app ./cmd/app", "delay": "300ms"},
+  "watch": {"exclude_dirs": {"append": ["dist"]}}
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, tt.name)
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("write config file: %v", err)
+			}
+
+			cfg, err := LoadWithDefaults(configPath)
+			if err != nil {
+				t.Fatalf("LoadWithDefaults() error = %v", err)
+			}
+			if cfg.Build.Cmd != "go build -o ./tmp/app ./cmd/app" {
+				t.Errorf("Build.Cmd = %v", cfg.Build.Cmd)
+			}
+			if cfg.Build.Delay != 300*time.Millisecond {
+				t.Errorf("Build.Delay = %v, want 300ms", cfg.Build.Delay)
+			}
+			if got := cfg.Watch.ExcludeDirs; got[len(got)-1] != "dist" {
+				t.Errorf("Watch.ExcludeDirs = %v, want dist appended", got)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if got := Find(tmpDir); got != "" {
+		t.Errorf("Find() = %v, want empty", got)
+	}
+
+	tomlPath := filepath.Join(tmpDir, "goreload.toml")
+	if err := os.WriteFile(tomlPath, []byte(""), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	if got := Find(tmpDir); got != tomlPath {
+		t.Errorf("Find() = %v, want %v", got, tomlPath)
+	}
+
+	yamlPath := filepath.Join(tmpDir, DefaultConfigFile)
+	if err := os.WriteFile(yamlPath, []byte(""), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	if got := Find(tmpDir); got != yamlPath {
+		t.Errorf("Find() = %v, want %v", got, yamlPath)
+	}
+}
+
+func TestWriteInit(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+
+	opts := InitOptions{
+		BuildCmd: "go build -ldflags='-s -w' -o ./build/api ./cmd/api",
+		Bin:      "./build/api",
+		TmpDir:   "build",
+	}
+	if err := WriteInit(configPath, opts); err != nil {
+		t.Fatalf("WriteInit() error = %v", err)
+	}
+
+	cfg, err := LoadWithDefaults(configPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() on generated file error = %v", err)
+	}
+	if cfg.Build.Cmd != opts.BuildCmd {
+		t.Errorf("Build.Cmd = %v, want %v", cfg.Build.Cmd, opts.BuildCmd)
+	}
+	if cfg.Build.Bin != opts.Bin {
+		t.Errorf("Build.Bin = %v, want %v", cfg.Build.Bin, opts.Bin)
+	}
+	if cfg.TmpDir != "build" || cfg.Watch.ExcludeDirs[0] != "build" {
+		t.Errorf("TmpDir = %v, ExcludeDirs = %v, want build", cfg.TmpDir, cfg.Watch.ExcludeDirs)
+	}
+}
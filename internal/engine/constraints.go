@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"path/filepath"
+
+	"github.com/taro33333/goreload/internal/builder"
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/logger"
+	"github.com/taro33333/goreload/internal/project"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// buildConstraints describes the environment the build command compiles for:
+// the go command's GOOS, GOARCH and CGO_ENABLED, and the -tags of a "go
+// build" command. It returns nil unless build constraints are applied. If
+// "go env" fails, the go/build defaults are returned along with the error.
+func buildConstraints(ctx context.Context, cfg *config.Config) (*watcher.BuildConstraints, error) {
+	if !cfg.Watch.BuildConstraints {
+		return nil, nil
+	}
+
+	c := &watcher.BuildConstraints{
+		GOOS:       build.Default.GOOS,
+		GOARCH:     build.Default.GOARCH,
+		CgoEnabled: build.Default.CgoEnabled,
+	}
+	if gb, ok := builder.ParseGoBuild(cfg.Build.Cmd); ok {
+		c.Tags = gb.Tags
+	}
+
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return c, fmt.Errorf("resolve root: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, depsTimeout)
+	defer cancel()
+	env, err := project.GoEnv(ctx, root, "GOOS", "GOARCH", "CGO_ENABLED")
+	if err != nil {
+		return c, fmt.Errorf("%w (using %s)", err, c)
+	}
+	c.GOOS = env["GOOS"]
+	c.GOARCH = env["GOARCH"]
+	c.CgoEnabled = env["CGO_ENABLED"] == "1"
+	return c, nil
+}
+
+// logSkipped returns a watcher.Config.OnSkip callback that logs at debug
+// level why a change was ignored.
+func logSkipped(log logger.Logger, root string) func(path, reason string) {
+	return func(path, reason string) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+		log.Debug("ignoring %s: %s", path, reason)
+	}
+}
@@ -3,13 +3,17 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/taro33333/goreload/internal/builder"
 	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/events"
 	"github.com/taro33333/goreload/internal/logger"
 	"github.com/taro33333/goreload/internal/runner"
 	"github.com/taro33333/goreload/internal/watcher"
@@ -23,12 +27,131 @@ type Engine struct {
 	runner  runner.Runner
 	watcher watcher.Watcher
 
+	// configWatcher reports changes to the config files so they can be
+	// reloaded. It is nil when running with the built-in defaults.
+	configWatcher watcher.Watcher
+	// configFiles are the files followed by configWatcher.
+	configFiles []string
+	// set holds the local modules and dependency directories the current
+	// watcher was created for.
+	set watchSet
+	// stale is set when a change may have altered the packages the build
+	// target uses, so that the next successful build lists them again.
+	stale bool
+	// carried holds the changes a replaced watcher had not delivered yet.
+	// The run loop handles them before waiting for new ones.
+	carried []watcher.Event
+
+	// reported holds the watcher's drop counters already logged.
+	reported watcher.Stats
+
+	// build is the time span of the last build and loops tracks files that
+	// trigger a rebuild right after every build.
+	build buildWindow
+	loops loopDetector
+
+	// restarts tracks restarts against the run limits. crashLoop is when
+	// a limit was hit and rebuilds paused until the next change, or zero.
+	restarts  restartLimiter
+	crashLoop time.Time
+
+	// pauseRequest is the state asked for by Pause and Resume, which wake
+	// the run loop through pauseWake. paused is the state the run loop is
+	// in, pausedEvents the changes it collected meanwhile, pausedConfig and
+	// pausedModules whether the config files or go.mod and go.work changed
+	// meanwhile, and pauseFile whether PauseFile was present when last
+	// checked.
+	pauseRequest  atomic.Bool
+	pauseWake     chan struct{}
+	paused        bool
+	pausedEvents  []watcher.Event
+	pausedConfig  bool
+	pausedModules bool
+	pauseFile     bool
+
+	// events receives the lifecycle events; eventsFailed is set once
+	// writing to it failed. stdout receives the application's output.
+	events       *events.Stream
+	eventsFailed atomic.Bool
+	stdout       io.Writer
+
 	mu      sync.Mutex
 	running bool
 }
 
+// Options holds optional engine settings.
+type Options struct {
+	// Events, if set, receives a lifecycle event for every step of the
+	// watch-build-run cycle.
+	Events *events.Stream
+	// Stdout receives the application's standard output. It defaults to
+	// os.Stdout.
+	Stdout io.Writer
+}
+
 // New creates a new Engine with the given configuration.
-func New(cfg *config.Config, log logger.Logger) (*Engine, error) {
+func New(cfg *config.Config, log logger.Logger, opts Options) (*Engine, error) {
+	e := &Engine{
+		cfg:       cfg,
+		log:       log,
+		events:    opts.Events,
+		stdout:    opts.Stdout,
+		pauseWake: make(chan struct{}, 1),
+	}
+
+	b, err := newBuilder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := e.newRunner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := resolveWatchSet(context.Background(), cfg)
+	if err != nil {
+		log.Warn("%v", err)
+	}
+
+	w, err := newWatcher(cfg, set, watcher.Backend(cfg.Watch.Backend), log)
+	if err != nil {
+		return nil, err
+	}
+
+	e.builder = b
+	e.runner = r
+	e.watcher = w
+	e.set = set
+
+	if files := configFiles(cfg); len(files) > 0 {
+		e.configWatcher, err = newConfigWatcher(files, cfg, w.Backend())
+		if err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+		e.configFiles = files
+	}
+
+	return e, nil
+}
+
+// newConfigWatcher watches the config files using the backend chosen for the
+// project files, so that an "auto" backend is only probed once.
+func newConfigWatcher(files []string, cfg *config.Config, backend watcher.Backend) (watcher.Watcher, error) {
+	w, err := watcher.New(watcher.Config{
+		Files:        files,
+		Debounce:     cfg.Build.Delay,
+		Backend:      backend,
+		PollInterval: cfg.Watch.PollInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create config watcher: %w", err)
+	}
+	return w, nil
+}
+
+func newBuilder(cfg *config.Config) (builder.Builder, error) {
 	root, err := cfg.AbsRoot()
 	if err != nil {
 		return nil, fmt.Errorf("resolve root: %w", err)
@@ -39,45 +162,98 @@ func New(cfg *config.Config, log logger.Logger) (*Engine, error) {
 		return nil, fmt.Errorf("resolve tmp dir: %w", err)
 	}
 
-	b := builder.New(builder.Config{
+	return builder.New(builder.Config{
 		Cmd:    cfg.Build.Cmd,
 		Bin:    cfg.Build.Bin,
 		TmpDir: tmpDir,
 		Root:   root,
-	})
+	}), nil
+}
+
+func (e *Engine) newRunner(cfg *config.Config) (runner.Runner, error) {
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
 
-	r := runner.New(runner.Config{
+	return runner.New(runner.Config{
 		Bin:       cfg.Build.Bin,
 		Args:      cfg.Build.Args,
 		Root:      root,
 		KillDelay: cfg.Build.KillDelay,
-	})
+		Stdout:    e.stdout,
+		OnExit:    e.emitProcessExited,
+	}), nil
+}
+
+// newWatcher creates the watcher for cfg's watch settings and the
+// directories in set, using backend to detect changes. Ignored changes are
+// logged to log.
+func newWatcher(cfg *config.Config, set watchSet, backend watcher.Backend, log logger.Logger) (watcher.Watcher, error) {
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+
+	// The build output never triggers a rebuild, whatever tmp_dir is called.
+	tmpDir, err := cfg.AbsTmpDir()
+	if err != nil {
+		return nil, fmt.Errorf("resolve tmp dir: %w", err)
+	}
+	var excludePaths []string
+	if tmpDir != root {
+		excludePaths = append(excludePaths, tmpDir)
+	}
 
 	f := watcher.NewFilter(watcher.FilterConfig{
 		Extensions:   cfg.Watch.Extensions,
 		ExcludeDirs:  cfg.Watch.ExcludeDirs,
 		ExcludeFiles: cfg.Watch.ExcludeFiles,
 		Root:         root,
+		Include:      cfg.Watch.Include,
+		Names:        cfg.Watch.Names,
+		Exclude:      cfg.Watch.Exclude,
+		GitIgnore:    cfg.Watch.GitIgnore,
 	})
 
+	var ignoreOps watcher.Op
+	for _, name := range cfg.Watch.IgnoreOps {
+		op, err := watcher.ParseOp(name)
+		if err != nil {
+			return nil, fmt.Errorf("parse ignore_ops: %w", err)
+		}
+		ignoreOps |= op
+	}
+
 	w, err := watcher.New(watcher.Config{
-		Dirs:        cfg.Watch.Dirs,
-		Filter:      f,
-		Debounce:    cfg.Build.Delay,
-		Root:        root,
-		ExcludeDirs: cfg.Watch.ExcludeDirs,
+		Dirs:              set.dirs(cfg),
+		Files:             cfg.Watch.Files,
+		Filter:            f,
+		Debounce:          debounceDelay(cfg),
+		Root:              root,
+		ExcludeDirs:       cfg.Watch.ExcludeDirs,
+		Backend:           backend,
+		PollInterval:      cfg.Watch.PollInterval,
+		PollHash:          cfg.Watch.PollHash,
+		IgnoreOps:         ignoreOps,
+		IgnoreUnchanged:   cfg.Watch.IgnoreUnchanged,
+		IgnoreEditorFiles: cfg.Watch.IgnoreEditorFiles,
+		PollOverflow:      cfg.Watch.PollOverflow,
+		Flat:              set.flat(),
+		FollowSymlinks:    cfg.Watch.FollowSymlinks,
+		Constraints:       set.constraints,
+		OnSkip:            logSkipped(log, root),
+		Hold:              set.git.hold(log),
+		DebounceMode:      watcher.DebounceMode(cfg.Watch.Debounce.Mode),
+		MaxWait:           cfg.Watch.Debounce.MaxWait,
+		AdaptiveDebounce:  cfg.Watch.Debounce.Adaptive,
+		Embeds:            set.embeds,
+		ExcludePaths:      excludePaths,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create watcher: %w", err)
 	}
-
-	return &Engine{
-		cfg:     cfg,
-		log:     log,
-		builder: b,
-		runner:  r,
-		watcher: w,
-	}, nil
+	return w, nil
 }
 
 // Run starts the main engine loop.
@@ -96,26 +272,29 @@ func (e *Engine) Run(ctx context.Context) error {
 		e.mu.Unlock()
 	}()
 
-	root, _ := e.cfg.AbsRoot()
-
-	// Log watched directories.
-	for _, dir := range e.cfg.Watch.Dirs {
-		if !filepath.IsAbs(dir) {
-			dir = filepath.Join(root, dir)
-		}
-		e.log.Info("watching: %s", dir)
-	}
-
-	// Log excluded directories.
-	if len(e.cfg.Watch.ExcludeDirs) > 0 {
-		e.log.Info("excluding: %v", e.cfg.Watch.ExcludeDirs)
-	}
+	e.logWatchSettings()
 
 	// Start watcher.
-	if err := e.watcher.Start(ctx); err != nil {
+	if err := e.startWatcher(ctx, e.watcher); err != nil {
 		return fmt.Errorf("start watcher: %w", err)
 	}
-	defer func() { _ = e.watcher.Close() }()
+	defer func() { _ = e.currentWatcher().Close() }()
+	e.log.Debug("watching %d directories", e.watcher.Stats().WatchedDirs)
+	e.emitWatchStarted()
+
+	// Start watching the config files for changes.
+	if e.configWatcher != nil {
+		if err := e.configWatcher.Start(ctx); err != nil {
+			e.log.Warn("config reload disabled: %v", err)
+			_ = e.configWatcher.Close()
+			e.configWatcher = nil
+		}
+	}
+	defer func() {
+		if e.configWatcher != nil {
+			_ = e.configWatcher.Close()
+		}
+	}()
 
 	// Initial build and run.
 	if err := e.buildAndRun(ctx); err != nil {
@@ -123,14 +302,24 @@ func (e *Engine) Run(ctx context.Context) error {
 		// Continue watching for changes even if initial build fails.
 	}
 
+	pauseTicker := time.NewTicker(pauseFileInterval)
+	defer pauseTicker.Stop()
+
 	// Main loop.
 	for {
+		if batch := e.carried; batch != nil {
+			e.carried = nil
+			e.handleEvents(ctx, batch)
+			continue
+		}
+
 		select {
 		case <-ctx.Done():
 			e.log.Info("shutting down...")
 			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			_ = e.runner.Stop(stopCtx)
 			cancel()
+			e.emit(events.Shutdown, nil)
 			return ctx.Err()
 
 		case evt, ok := <-e.watcher.Events():
@@ -138,16 +327,20 @@ func (e *Engine) Run(ctx context.Context) error {
 				return nil
 			}
 
-			relPath, err := filepath.Rel(root, evt.Path)
-			if err != nil {
-				relPath = evt.Path
-			}
-			e.log.Info("%s changed", relPath)
+			e.handleEvents(ctx, drainEvents(evt, e.watcher.Events()))
+
+		case <-pauseTicker.C:
+			e.checkPauseFile()
 
-			if err := e.buildAndRun(ctx); err != nil {
-				e.log.Error("rebuild failed: %v", err)
+		case <-e.pauseWake:
+			batch := e.applyPause()
+			if !e.paused {
+				e.resume(ctx, batch)
 			}
 
+		case evt := <-e.configEvents():
+			e.handleConfigChange(ctx, evt)
+
 		case err, ok := <-e.watcher.Errors():
 			if !ok {
 				return nil
@@ -157,20 +350,192 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 }
 
-func (e *Engine) buildAndRun(ctx context.Context) error {
-	// Stop current process.
-	if e.runner.Running() {
-		stopCtx, cancel := context.WithTimeout(ctx, e.cfg.Build.KillDelay*2)
-		if err := e.runner.Stop(stopCtx); err != nil {
-			cancel()
-			e.log.Warn("failed to stop process: %v", err)
+// handleEvents filters a batch of watcher events and handles what is left,
+// unless rebuilds are paused.
+func (e *Engine) handleEvents(ctx context.Context, batch []watcher.Event) {
+	batch = e.dropLoopEvents(batch)
+	if len(batch) == 0 {
+		return
+	}
+	if e.paused {
+		e.collectPaused(batch)
+		return
+	}
+	if batch = e.throttle(ctx, batch); batch == nil {
+		return
+	}
+	e.handleChanges(ctx, batch)
+}
+
+// handleChanges rebuilds and restarts the application for batch.
+func (e *Engine) handleChanges(ctx context.Context, batch []watcher.Event) {
+	if !e.retryCrashLoop(batch) {
+		return
+	}
+	e.logChanges(batch)
+	e.emitFilesChanged(batch)
+	e.set.git.checkHead(e.log)
+	e.detectLoops(batch)
+	e.reportDrops()
+	if touchesPackages(batch) {
+		e.stale = true
+	}
+
+	if ok, reason := e.restarts.allow(e.cfg.Run, time.Now()); !ok {
+		e.pauseCrashLoop(ctx, reason)
+		return
+	}
+	if err := e.buildAndRun(ctx); err != nil {
+		e.log.Error("rebuild failed: %v", err)
+	}
+}
+
+// drainEvents returns evt and the events already queued behind it, so that
+// a burst of changes leads to a single rebuild.
+func drainEvents(evt watcher.Event, events <-chan watcher.Event) []watcher.Event {
+	return append([]watcher.Event{evt}, pendingEvents(events)...)
+}
+
+func (e *Engine) logChanges(batch []watcher.Event) {
+	for _, evt := range batch {
+		if evt.Op == watcher.OpRescan {
+			e.log.Warn("file system events were lost, rescanned %s and rebuilding", e.relPath(evt.Path))
+			return
+		}
+	}
+
+	if len(batch) == 1 {
+		e.log.Info("%s changed", e.relPath(batch[0].Path))
+	} else {
+		e.log.Info("%s and %d more files changed", e.relPath(batch[0].Path), len(batch)-1)
+	}
+	for _, evt := range batch {
+		e.log.Debug("%s %s", evt.Op, e.relPath(evt.Path))
+	}
+}
+
+// reportDrops logs events and errors the watcher dropped since the last call.
+func (e *Engine) reportDrops() {
+	stats := e.watcher.Stats()
+	e.log.Debug("watching %d directories", stats.WatchedDirs)
+
+	if n := stats.DroppedEvents - e.reported.DroppedEvents; n > 0 {
+		e.log.Warn("watcher dropped %d events while busy; they are covered by this rebuild", n)
+	}
+	if n := stats.DroppedErrors - e.reported.DroppedErrors; n > 0 {
+		e.log.Warn("watcher dropped %d errors", n)
+	}
+	e.reported = stats
+}
+
+// startWatcher starts w and reports directories that are polled because the
+// system limit on watches was reached.
+func (e *Engine) startWatcher(ctx context.Context, w watcher.Watcher) error {
+	if err := w.Start(ctx); err != nil {
+		var limitErr *watcher.LimitError
+		if errors.As(err, &limitErr) {
+			return fmt.Errorf("%w; or set watch.poll_overflow to poll the remaining directories", err)
+		}
+		return err
+	}
+
+	if n := w.Stats().PolledDirs; n > 0 {
+		e.log.Warn("watch limit reached, polling %d directories every %s", n, e.cfg.Watch.PollInterval)
+	}
+	return nil
+}
+
+func (e *Engine) logWatchSettings() {
+	root, _ := e.cfg.AbsRoot()
+
+	if e.cfg.Profile != "" {
+		e.log.Info("profile: %s", e.cfg.Profile)
+	}
+
+	// Log watched directories. The dependency scope replaces them.
+	if !e.set.flat() {
+		for _, dir := range e.cfg.Watch.Dirs {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			e.log.Info("watching: %s", dir)
+		}
+	}
+	for _, file := range e.cfg.Watch.Files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(root, file)
 		}
-		cancel()
+		e.log.Info("watching file: %s", file)
 	}
+	if len(e.cfg.Watch.Names) > 0 {
+		e.log.Info("watching names: %v", e.cfg.Watch.Names)
+	}
+	e.logWatchSet()
+
+	// Log excluded directories.
+	if len(e.cfg.Watch.ExcludeDirs) > 0 {
+		e.log.Info("excluding: %v", e.cfg.Watch.ExcludeDirs)
+	}
+	if e.cfg.Watch.GitIgnore {
+		e.log.Debug("honoring .gitignore files")
+	}
+
+	backend := e.watcher.Backend()
+	switch {
+	case backend == watcher.BackendPoll && e.cfg.Watch.Backend == string(watcher.BackendAuto):
+		e.log.Info("backend: poll every %s (no file system events received)", e.cfg.Watch.PollInterval)
+	case backend == watcher.BackendPoll:
+		e.log.Info("backend: poll every %s", e.cfg.Watch.PollInterval)
+	default:
+		e.log.Debug("backend: %s", backend)
+	}
+
+	d := e.cfg.Watch.Debounce
+	e.log.Debug("debounce: %s %s, max_wait %s, throttle %s, adaptive %v",
+		d.Mode, debounceDelay(e.cfg), d.MaxWait, d.Throttle, d.Adaptive)
+}
+
+func (e *Engine) relPath(path string) string {
+	root, err := e.cfg.AbsRoot()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// configEvents returns the config watcher's events, or nil when config files
+// are not watched.
+func (e *Engine) configEvents() <-chan watcher.Event {
+	if e.configWatcher == nil {
+		return nil
+	}
+	return e.configWatcher.Events()
+}
+
+func (e *Engine) currentWatcher() watcher.Watcher {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.watcher
+}
+
+func (e *Engine) buildAndRun(ctx context.Context) error {
+	defer func() {
+		e.emit(events.Ready, events.ReadyData{Running: e.runner.Running()})
+	}()
+
+	e.stopProcess(ctx)
 
 	// Build.
 	e.log.Info("building...")
+	e.emit(events.BuildStarted, events.BuildStartedData{Command: e.cfg.Build.Cmd})
+	start := time.Now()
 	result := e.builder.Build(ctx)
+	e.build.start, e.build.end = start, time.Now()
+	e.emitBuildFinished(result)
 
 	if !result.Success {
 		if result.Output != "" {
@@ -182,13 +547,40 @@ func (e *Engine) buildAndRun(ctx context.Context) error {
 
 	logger.Success(e.log, "build completed (%.2fs)", result.Duration.Seconds())
 
-	// Run.
+	err := e.startProcess(ctx)
+	// Imports and embedded files may have changed with this build.
+	if e.stale {
+		e.stale = false
+		e.refreshPackages(ctx)
+	}
+	return err
+}
+
+// stopProcess stops the current process, if any.
+func (e *Engine) stopProcess(ctx context.Context) {
+	if !e.runner.Running() {
+		return
+	}
+
+	// Leave time for the kill after a zero kill_delay.
+	stopCtx, cancel := context.WithTimeout(ctx, max(e.cfg.Build.KillDelay*2, time.Second))
+	defer cancel()
+	if err := e.runner.Stop(stopCtx); err != nil {
+		e.log.Warn("failed to stop process: %v", err)
+	}
+}
+
+// startProcess runs the most recently built binary.
+func (e *Engine) startProcess(ctx context.Context) error {
 	if err := e.runner.Start(ctx); err != nil {
 		logger.Failure(e.log, "failed to start: %v", err)
 		return err
 	}
+	e.build.started = time.Now()
 
+	e.restarts.record(time.Now())
 	logger.Success(e.log, "running %s", e.cfg.Build.Bin)
+	e.emit(events.ProcessStarted, events.ProcessStartedData{PID: e.runner.PID(), Bin: e.cfg.Build.Bin})
 	return nil
 }
 
@@ -205,6 +597,12 @@ func (e *Engine) Stop(ctx context.Context) error {
 		return fmt.Errorf("stop runner: %w", err)
 	}
 
+	if e.configWatcher != nil {
+		if err := e.configWatcher.Close(); err != nil {
+			return fmt.Errorf("close config watcher: %w", err)
+		}
+	}
+
 	if err := e.watcher.Close(); err != nil {
 		return fmt.Errorf("close watcher: %w", err)
 	}
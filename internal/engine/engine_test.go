@@ -1,12 +1,21 @@
 package engine
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/events"
 	"github.com/taro33333/goreload/internal/logger"
+	"github.com/taro33333/goreload/internal/watcher"
 )
 
 func TestNew(t *testing.T) {
@@ -39,7 +48,7 @@ func TestNew(t *testing.T) {
 		Level: "info",
 	})
 
-	eng, err := New(cfg, log)
+	eng, err := New(cfg, log, Options{})
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -78,7 +87,7 @@ func TestEngine_RunWithContextCancel(t *testing.T) {
 		Level: "error",
 	})
 
-	eng, err := New(cfg, log)
+	eng, err := New(cfg, log, Options{})
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -101,6 +110,65 @@ func TestEngine_RunWithContextCancel(t *testing.T) {
 	}
 }
 
+func TestEngine_Events(t *testing.T) {
+	cfg := config.Default()
+	cfg.Root = t.TempDir()
+	cfg.Build.Cmd = "echo test"
+	cfg.Build.Bin = filepath.Join(cfg.Root, "app.sh")
+	cfg.Build.KillDelay = 100 * time.Millisecond
+	cfg.Build.Delay = 50 * time.Millisecond
+	cfg.Log.Level = "error"
+	if err := os.WriteFile(cfg.Build.Bin, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	var buf bytes.Buffer
+	eng, err := New(cfg, logger.New(logger.Config{Level: "error"}), Options{
+		Events: events.NewStream(&buf),
+		Stdout: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(cfg.Root, "main.go"), []byte("package main\n"), 0644)
+	}()
+	if err := eng.Run(ctx); err != nil && err != context.DeadlineExceeded {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var types []events.Type
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var evt struct {
+			Schema int         `json:"schema"`
+			Type   events.Type `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(line), &evt); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if evt.Schema != events.SchemaVersion {
+			t.Errorf("schema = %d, want %d", evt.Schema, events.SchemaVersion)
+		}
+		types = append(types, evt.Type)
+	}
+
+	// The previous process has exited before the next build starts.
+	want := []events.Type{
+		events.WatchStarted, events.BuildStarted, events.BuildFinished,
+		events.ProcessStarted, events.Ready,
+		events.FilesChanged, events.ProcessExited, events.BuildStarted, events.BuildFinished,
+		events.ProcessStarted, events.Ready,
+		events.ProcessExited, events.Shutdown,
+	}
+	if !slices.Equal(types, want) {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+}
+
 func TestEngine_DoubleRun(t *testing.T) {
 	cfg := &config.Config{
 		Root:   t.TempDir(),
@@ -131,7 +199,7 @@ func TestEngine_DoubleRun(t *testing.T) {
 		Level: "error",
 	})
 
-	eng, err := New(cfg, log)
+	eng, err := New(cfg, log, Options{})
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -187,7 +255,7 @@ func TestEngine_Stop(t *testing.T) {
 		Level: "error",
 	})
 
-	eng, err := New(cfg, log)
+	eng, err := New(cfg, log, Options{})
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -198,3 +266,867 @@ func TestEngine_Stop(t *testing.T) {
 		t.Errorf("Stop() error = %v when not running", err)
 	}
 }
+
+func TestDiffConfig(t *testing.T) {
+	base := func() *config.Config {
+		cfg := config.Default()
+		cfg.Root = "/project"
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cfg *config.Config)
+		want   change
+	}{
+		{
+			name:   "unchanged",
+			modify: func(cfg *config.Config) {},
+			want:   0,
+		},
+		{
+			name:   "args change restarts only",
+			modify: func(cfg *config.Config) { cfg.Build.Args = []string{"-v"} },
+			want:   changeRun,
+		},
+		{
+			name:   "exclude dir change rebuilds watcher only",
+			modify: func(cfg *config.Config) { cfg.Watch.ExcludeDirs = append(cfg.Watch.ExcludeDirs, "dist") },
+			want:   changeWatch,
+		},
+		{
+			name:   "delay change rebuilds watcher only",
+			modify: func(cfg *config.Config) { cfg.Build.Delay = time.Second },
+			want:   changeWatch,
+		},
+		{
+			name:   "build command change rebuilds watcher and build",
+			modify: func(cfg *config.Config) { cfg.Build.Cmd = "go build -tags integration -o ./tmp/main ." },
+			want:   changeWatch | changeBuild,
+		},
+		{
+			name:   "bin change rebuilds and restarts",
+			modify: func(cfg *config.Config) { cfg.Build.Bin = "./tmp/app" },
+			want:   changeBuild | changeRun,
+		},
+		{
+			name:   "tmp dir change rebuilds watcher and build",
+			modify: func(cfg *config.Config) { cfg.TmpDir = "out" },
+			want:   changeWatch | changeBuild,
+		},
+		{
+			name:   "log level change",
+			modify: func(cfg *config.Config) { cfg.Log.Level = "debug" },
+			want:   changeLog,
+		},
+		{
+			name:   "log time change",
+			modify: func(cfg *config.Config) { cfg.Log.Time = !cfg.Log.Time },
+			want:   changeLog,
+		},
+		{
+			name:   "restart limit change",
+			modify: func(cfg *config.Config) { cfg.Run.MaxRestartsPerMinute = 5 },
+			want:   changeLimits,
+		},
+		{
+			name:   "root change affects everything",
+			modify: func(cfg *config.Config) { cfg.Root = "/other" },
+			want:   changeWatch | changeBuild | changeRun | changeLog,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			tt.modify(cfg)
+			if got := diffConfig(base(), cfg); got != tt.want {
+				t.Errorf("diffConfig() = %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_ReloadInvalidConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+	content := `
+root: "` + tmpDir + `"
+build:
+  cmd: "echo test"
+  bin: "/bin/echo"
+log:
+  level: "error"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := config.LoadWithDefaults(configPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() error = %v", err)
+	}
+
+	log := logger.New(logger.Config{
+		Color: false,
+		Time:  false,
+		Level: "error",
+	})
+	log.SetOutput(io.Discard)
+
+	eng, err := New(cfg, log, Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("build:\n  delay: \"invalid\"\n"), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	eng.reload(context.Background())
+
+	if eng.cfg != cfg {
+		t.Error("reload() replaced config with an invalid one")
+	}
+}
+
+func TestEngine_ReplaceWatcherCarriesEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+	content := `
+root: "` + tmpDir + `"
+watch:
+  debounce:
+    delay: "10s"
+build:
+  cmd: "echo test"
+  bin: "/bin/echo"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := config.LoadWithDefaults(configPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() error = %v", err)
+	}
+
+	log := logger.New(logger.Config{Level: "error"})
+	log.SetOutput(io.Discard)
+
+	eng, err := New(cfg, log, Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := eng.startWatcher(ctx, eng.watcher); err != nil {
+		t.Fatalf("startWatcher() error = %v", err)
+	}
+
+	goFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := eng.replaceWatcher(ctx, cfg, eng.set); err != nil {
+		t.Fatalf("replaceWatcher() error = %v", err)
+	}
+	defer eng.watcher.Close()
+
+	if len(eng.carried) != 1 || eng.carried[0].Path != goFile {
+		t.Errorf("carried = %v, want the change to %s", eng.carried, goFile)
+	}
+}
+
+func TestEngine_ReloadTmpDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+	content := `
+root: "` + tmpDir + `"
+tmp_dir: "tmp"
+watch:
+  debounce:
+    delay: "50ms"
+build:
+  cmd: "echo test"
+  bin: "/bin/echo"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := config.LoadWithDefaults(configPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() error = %v", err)
+	}
+
+	log := logger.New(logger.Config{Level: "error"})
+	log.SetOutput(io.Discard)
+
+	eng, err := New(cfg, log, Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := eng.startWatcher(ctx, eng.watcher); err != nil {
+		t.Fatalf("startWatcher() error = %v", err)
+	}
+
+	out := filepath.Join(tmpDir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content = strings.Replace(content, `tmp_dir: "tmp"`, `tmp_dir: "out"`, 1)
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	if c := eng.applyConfig(ctx); !c.has(changeWatch) {
+		t.Fatalf("applyConfig() = %b, want the watcher replaced", c)
+	}
+	defer eng.watcher.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// Build output in the renamed directory must not trigger a rebuild.
+	if err := os.WriteFile(filepath.Join(out, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	select {
+	case evt := <-eng.watcher.Events():
+		t.Errorf("unexpected event in the new tmp_dir: %+v", evt)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestEngine_ReloadBuildTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "goreload.yaml")
+	content := `
+root: "` + tmpDir + `"
+watch:
+  debounce:
+    delay: "50ms"
+build:
+  cmd: "go build -o ./tmp/main ."
+  bin: "./tmp/main"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	tagged := filepath.Join(tmpDir, "integration.go")
+	if err := os.WriteFile(tagged, []byte("//go:build integration\n\npackage main\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	cfg, err := config.LoadWithDefaults(configPath)
+	if err != nil {
+		t.Fatalf("LoadWithDefaults() error = %v", err)
+	}
+
+	log := logger.New(logger.Config{Level: "error"})
+	log.SetOutput(io.Discard)
+
+	eng, err := New(cfg, log, Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := eng.startWatcher(ctx, eng.watcher); err != nil {
+		t.Fatalf("startWatcher() error = %v", err)
+	}
+
+	content = strings.Replace(content, "go build -o", "go build -tags integration -o", 1)
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	eng.applyConfig(ctx)
+	defer eng.watcher.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// The file is part of the build with the new tags.
+	if err := os.WriteFile(tagged, []byte("//go:build integration\n\npackage main\n\nvar x int\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	select {
+	case evt := <-eng.watcher.Events():
+		if evt.Path != tagged {
+			t.Errorf("Event path = %v, want %v", evt.Path, tagged)
+		}
+	case <-time.After(time.Second):
+		t.Error("change to a file included by the new build tags was dropped")
+	}
+}
+
+func TestDrainEvents(t *testing.T) {
+	events := make(chan watcher.Event, 4)
+	events <- watcher.Event{Path: "b.go", Op: watcher.OpWrite}
+	events <- watcher.Event{Path: "c.go", Op: watcher.OpCreate}
+
+	batch := drainEvents(watcher.Event{Path: "a.go", Op: watcher.OpWrite}, events)
+
+	if len(batch) != 3 {
+		t.Fatalf("drainEvents() returned %d events, want 3", len(batch))
+	}
+	for i, want := range []string{"a.go", "b.go", "c.go"} {
+		if batch[i].Path != want {
+			t.Errorf("batch[%d].Path = %q, want %q", i, batch[i].Path, want)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("%d events left in channel, want 0", len(events))
+	}
+}
+
+func TestLocalModules(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+	base := t.TempDir()
+	root := filepath.Join(base, "app")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module example.com/app\n\ngo 1.22\n\nreplace example.com/lib => ../lib\n\nreplace example.com/vendored => ./third_party/vendored\n"
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Root = root
+
+	modules, err := localModules(cfg)
+	if err != nil {
+		t.Fatalf("localModules() error = %v", err)
+	}
+	// ./third_party/vendored is already watched through the root.
+	if want := []string{filepath.Join(base, "lib")}; !slices.Equal(modules, want) {
+		t.Errorf("localModules() = %v, want %v", modules, want)
+	}
+
+	cfg.Watch.LocalModules = false
+	if modules, _ := localModules(cfg); modules != nil {
+		t.Errorf("localModules() = %v with local_modules disabled, want nil", modules)
+	}
+}
+
+func TestListPackages(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":                  "module example.com/app\n\ngo 1.22\n",
+		"main.go":                 "package main\n\nimport \"example.com/app/internal/api\"\n\nfunc main() { api.Serve() }\n",
+		"internal/api/a.go":       "package api\n\nimport _ \"embed\"\n\n//go:embed index.html\nvar index string\n\nfunc Serve() {}\n",
+		"internal/api/index.html": "<html></html>\n",
+		"tools/gen/main.go":       "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Root = root
+	embeds := []watcher.EmbedPattern{{Dir: filepath.Join(root, "internal", "api"), Pattern: "index.html"}}
+
+	cfg.Watch.Embeds = false
+	if pkgs, err := listPackages(context.Background(), cfg); err != nil || pkgs.Dirs != nil {
+		t.Errorf("listPackages() with scope all = %v, %v, want nothing", pkgs, err)
+	}
+
+	cfg.Watch.Embeds = true
+	set, err := resolveWatchSet(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("resolveWatchSet() error = %v", err)
+	}
+	if set.flat() || !slices.Equal(set.embeds, embeds) {
+		t.Errorf("resolveWatchSet() with scope all = %+v, want embeds %v", set, embeds)
+	}
+
+	cfg.Watch.Scope = config.ScopeDeps
+	pkgs, err := listPackages(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("listPackages() error = %v", err)
+	}
+	want := []string{root, filepath.Join(root, "internal", "api")}
+	if !slices.Equal(pkgs.Dirs, want) {
+		t.Errorf("listPackages() = %v, want %v", pkgs.Dirs, want)
+	}
+
+	set.setPackages(cfg, pkgs)
+	if !set.flat() || !slices.Equal(set.dirs(cfg), want) || !slices.Equal(set.embeds, embeds) {
+		t.Errorf("watchSet dirs = %v, flat = %v, embeds = %v", set.dirs(cfg), set.flat(), set.embeds)
+	}
+
+	cfg.Build.Cmd = "make build"
+	if _, err := listPackages(context.Background(), cfg); err == nil {
+		t.Error("listPackages() error = nil for a non-go build command")
+	}
+
+	// Without the deps scope, other commands just have no embedded files.
+	cfg.Watch.Scope = config.ScopeAll
+	if pkgs, err := listPackages(context.Background(), cfg); err != nil || pkgs.EmbedPatterns != nil {
+		t.Errorf("listPackages() for a non-go build command = %v, %v, want nothing", pkgs, err)
+	}
+}
+
+func TestTouchesPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  bool
+	}{
+		{"go file", []string{"web/index.html", "main.go"}, true},
+		{"go.mod", []string{"go.mod"}, true},
+		{"go.sum", []string{"go.sum"}, false},
+		{"templates only", []string{"web/index.html", "web/app.css"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batch []watcher.Event
+			for _, path := range tt.paths {
+				batch = append(batch, watcher.Event{Path: path, Op: watcher.OpWrite})
+			}
+			if got := touchesPackages(batch); got != tt.want {
+				t.Errorf("touchesPackages(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConstraints(t *testing.T) {
+	t.Setenv("GOOS", "windows")
+	t.Setenv("GOARCH", "arm64")
+	t.Setenv("CGO_ENABLED", "0")
+
+	cfg := config.Default()
+	cfg.Root = t.TempDir()
+	cfg.Build.Cmd = "go build -tags dev,debug -o ./tmp/main ."
+
+	c, err := buildConstraints(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("buildConstraints() error = %v", err)
+	}
+	want := watcher.BuildConstraints{GOOS: "windows", GOARCH: "arm64", Tags: []string{"dev", "debug"}}
+	if c == nil || c.String() != want.String() || c.CgoEnabled {
+		t.Errorf("buildConstraints() = %+v, want %+v", c, want)
+	}
+
+	cfg.Watch.BuildConstraints = false
+	if c, err := buildConstraints(context.Background(), cfg); c != nil || err != nil {
+		t.Errorf("buildConstraints() when disabled = %+v, %v, want nil, nil", c, err)
+	}
+}
+
+func TestBuildWindow(t *testing.T) {
+	start := time.Now()
+	w := buildWindow{start: start, end: start.Add(time.Second)}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"before the build", start.Add(-time.Millisecond), false},
+		{"at the start", start, true},
+		{"during the build", start.Add(500 * time.Millisecond), true},
+		{"at the end", start.Add(time.Second), true},
+		{"after the build", start.Add(2 * time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.contains(tt.t); got != tt.want {
+				t.Errorf("contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (buildWindow{}).contains(start) {
+		t.Error("contains() = true before any build")
+	}
+
+	// The program's startup counts too, also after a restart without a build.
+	w.started = start.Add(5 * time.Second)
+	for _, tt := range []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"between build and start", start.Add(3 * time.Second), false},
+		{"during startup", w.started.Add(time.Second), true},
+		{"after startup", w.started.Add(loopWindow + time.Millisecond), false},
+	} {
+		if got := w.contains(tt.t); got != tt.want {
+			t.Errorf("contains() %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleDelay(t *testing.T) {
+	start := time.Now()
+	last := buildWindow{start: start, end: start.Add(2 * time.Second)}
+
+	tests := []struct {
+		name string
+		cfg  config.DebounceConfig
+		last buildWindow
+		now  time.Time
+		want time.Duration
+	}{
+		{"no throttle", config.DebounceConfig{}, last, last.end, 0},
+		{"no build yet", config.DebounceConfig{Throttle: time.Second}, buildWindow{}, start, 0},
+		{"right after the build", config.DebounceConfig{Throttle: time.Second}, last, last.end, time.Second},
+		{"partly waited", config.DebounceConfig{Throttle: time.Second}, last, last.end.Add(300 * time.Millisecond), 700 * time.Millisecond},
+		{"waited out", config.DebounceConfig{Throttle: time.Second}, last, last.end.Add(time.Minute), 0},
+		{"adaptive slow build", config.DebounceConfig{Throttle: time.Second, Adaptive: true}, last, last.end, 2 * time.Second},
+		{"adaptive fast build", config.DebounceConfig{Throttle: 3 * time.Second, Adaptive: true}, last, last.end, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := throttleDelay(tt.cfg, tt.last, tt.now); got != tt.want {
+				t.Errorf("throttleDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebounceDelay(t *testing.T) {
+	cfg := config.Default()
+	if got := debounceDelay(cfg); got != cfg.Build.Delay {
+		t.Errorf("debounceDelay() = %v, want build.delay %v", got, cfg.Build.Delay)
+	}
+
+	cfg.Watch.Debounce.Delay = 50 * time.Millisecond
+	if got := debounceDelay(cfg); got != 50*time.Millisecond {
+		t.Errorf("debounceDelay() = %v, want 50ms", got)
+	}
+}
+
+func TestRestartLimiter(t *testing.T) {
+	start := time.Now()
+
+	t.Run("min interval", func(t *testing.T) {
+		var l restartLimiter
+		cfg := config.RunConfig{MinRestartInterval: time.Second}
+		if ok, _ := l.allow(cfg, start); !ok {
+			t.Fatal("allow() = false for the first restart")
+		}
+		l.record(start)
+		ok, reason := l.allow(cfg, start.Add(200*time.Millisecond))
+		if ok {
+			t.Fatal("allow() = true for a restart within min_restart_interval")
+		}
+		if !strings.Contains(reason, "run.min_restart_interval is 1s") {
+			t.Errorf("reason = %q, want the limit", reason)
+		}
+		if ok, _ := l.allow(cfg, start.Add(time.Second)); !ok {
+			t.Error("allow() = false for a restart after min_restart_interval")
+		}
+	})
+
+	t.Run("per minute", func(t *testing.T) {
+		var l restartLimiter
+		cfg := config.RunConfig{MaxRestartsPerMinute: 3}
+		for i := range 3 {
+			now := start.Add(time.Duration(i) * time.Second)
+			if ok, _ := l.allow(cfg, now); !ok {
+				t.Fatalf("allow() = false for restart %d", i+1)
+			}
+			l.record(now)
+		}
+		ok, reason := l.allow(cfg, start.Add(10*time.Second))
+		if ok {
+			t.Fatal("allow() = true beyond max_restarts_per_minute")
+		}
+		if !strings.Contains(reason, "3 restarts in the last minute") {
+			t.Errorf("reason = %q, want the count", reason)
+		}
+		// The first restart leaves the window after a minute.
+		if ok, _ := l.allow(cfg, start.Add(time.Minute)); !ok {
+			t.Error("allow() = false once a restart left the window")
+		}
+
+		l.reset()
+		if ok, _ := l.allow(cfg, start.Add(time.Minute)); !ok {
+			t.Error("allow() = false after reset")
+		}
+	})
+
+	t.Run("failed builds do not count", func(t *testing.T) {
+		var l restartLimiter
+		cfg := config.RunConfig{MaxRestartsPerMinute: 1, MinRestartInterval: time.Second}
+		// Restarts that were allowed but never recorded, because the
+		// build failed and the application was not started.
+		for i := range 10 {
+			if ok, _ := l.allow(cfg, start.Add(time.Duration(i)*time.Millisecond)); !ok {
+				t.Fatalf("allow() = false after %d failed builds", i)
+			}
+		}
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		var l restartLimiter
+		for i := range 100 {
+			now := start.Add(time.Duration(i) * time.Millisecond)
+			if ok, _ := l.allow(config.RunConfig{}, now); !ok {
+				t.Fatalf("allow() = false without limits at restart %d", i+1)
+			}
+			l.record(now)
+		}
+	})
+}
+
+func TestLoopDetector(t *testing.T) {
+	var d loopDetector
+	end := time.Now()
+	immediate := func(paths ...string) []watcher.Event {
+		var batch []watcher.Event
+		for _, path := range paths {
+			batch = append(batch, watcher.Event{Path: path, Op: watcher.OpWrite, Time: end.Add(100 * time.Millisecond)})
+		}
+		return batch
+	}
+
+	for i := 1; i < loopThreshold; i++ {
+		if loops := d.observe(immediate("app.db", "main.go"), end); loops != nil {
+			t.Fatalf("observe() #%d = %v, want no loops yet", i, loops)
+		}
+	}
+	if loops := d.observe(immediate("app.db"), end); !slices.Equal(loops, []string{"app.db"}) {
+		t.Errorf("observe() = %v, want [app.db]", loops)
+	}
+	if !d.ignored["app.db"] || d.ignored["main.go"] {
+		t.Errorf("ignored = %v, want only app.db", d.ignored)
+	}
+	// Reported once per streak.
+	if loops := d.observe(immediate("app.db"), end); loops != nil {
+		t.Errorf("observe() = %v, want no repeated report", loops)
+	}
+
+	// A change long after the build breaks the streak.
+	late := []watcher.Event{{Path: "app.db", Op: watcher.OpWrite, Time: end.Add(time.Minute)}}
+	if loops := d.observe(late, end); loops != nil {
+		t.Errorf("observe() for a late change = %v, want none", loops)
+	}
+	for i := 1; i < loopThreshold; i++ {
+		if loops := d.observe(immediate("app.db"), end); loops != nil {
+			t.Fatalf("observe() #%d after a break = %v, want no loops yet", i, loops)
+		}
+	}
+}
+
+func TestEngine_DropLoopEvents(t *testing.T) {
+	log := logger.New(logger.Config{Level: "error"})
+	log.SetOutput(io.Discard)
+
+	start := time.Now()
+	e := &Engine{
+		cfg:   config.Default(),
+		log:   log,
+		build: buildWindow{start: start, end: start.Add(time.Second), started: start.Add(time.Second)},
+		loops: loopDetector{ignored: map[string]bool{"gen.go": true, "state.json": true}},
+	}
+	during := start.Add(500 * time.Millisecond)
+	startup := start.Add(2 * time.Second)
+	after := start.Add(time.Second + loopWindow + time.Second)
+
+	batch := e.dropLoopEvents([]watcher.Event{
+		{Path: "main.go", Op: watcher.OpWrite, Time: during},
+		{Path: "gen.go", Op: watcher.OpWrite, Time: during},
+		{Path: "state.json", Op: watcher.OpWrite, Time: startup},
+		{Path: "gen.go", Op: watcher.OpWrite, Time: after},
+	})
+
+	want := []watcher.Event{
+		{Path: "main.go", Op: watcher.OpWrite, Time: during},
+		{Path: "gen.go", Op: watcher.OpWrite, Time: after},
+	}
+	if !slices.Equal(batch, want) {
+		t.Errorf("dropLoopEvents() = %v, want an edit during the build and a loop file changed after startup", batch)
+	}
+}
+
+func TestGitState(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, ".git")
+	for name, content := range map[string]string{
+		"HEAD":             "ref: refs/heads/main\n",
+		"refs/heads/main":  "1111111111111111111111111111111111111111\n",
+		"refs/heads/topic": "2222222222222222222222222222222222222222\n",
+	} {
+		path := filepath.Join(gitDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Root = root
+	log := logger.New(logger.Config{Level: "error"})
+
+	g := newGitState(cfg)
+	if g == nil {
+		t.Fatal("newGitState() = nil in a repository")
+	}
+	hold := g.hold(log)
+	if hold() {
+		t.Error("hold() = true without a git operation")
+	}
+
+	lock := filepath.Join(gitDir, "index.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !hold() || !g.holding.Load() {
+		t.Error("hold() = false during a checkout")
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/topic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+	if hold() || g.holding.Load() {
+		t.Error("hold() = true after the checkout")
+	}
+
+	g.checkHead(log)
+	if g.head.Branch != "topic" || g.head.Commit != "2222222222222222222222222222222222222222" {
+		t.Errorf("head = %+v, want topic", g.head)
+	}
+
+	cfg.Watch.Git = false
+	if g := newGitState(cfg); g != nil || g.hold(log) != nil {
+		t.Error("newGitState() != nil with git disabled")
+	}
+}
+
+func TestEngine_Pause(t *testing.T) {
+	cfg := config.Default()
+	cfg.Root = t.TempDir()
+	e := &Engine{
+		cfg:       cfg,
+		log:       logger.New(logger.Config{Level: "error"}),
+		pauseWake: make(chan struct{}, 1),
+	}
+
+	e.Pause()
+	if !e.Paused() {
+		t.Fatal("Paused() = false after Pause()")
+	}
+	if batch := e.applyPause(); batch != nil {
+		t.Errorf("applyPause() = %v when pausing, want nil", batch)
+	}
+
+	e.collectPaused([]watcher.Event{{Path: "a.go", Op: watcher.OpWrite}, {Path: "b.go", Op: watcher.OpCreate}})
+	e.collectPaused([]watcher.Event{{Path: "a.go", Op: watcher.OpRemove}})
+
+	e.Resume()
+	<-e.pauseWake
+	batch := e.applyPause()
+	want := []watcher.Event{{Path: "a.go", Op: watcher.OpRemove}, {Path: "b.go", Op: watcher.OpCreate}}
+	if !slices.Equal(batch, want) {
+		t.Errorf("applyPause() = %v on resume, want %v", batch, want)
+	}
+
+	// Nothing changed during the second pause.
+	e.Pause()
+	e.applyPause()
+	e.Resume()
+	if batch := e.applyPause(); batch != nil {
+		t.Errorf("applyPause() = %v after an idle pause, want nil", batch)
+	}
+}
+
+func TestEngine_PausedConfigChange(t *testing.T) {
+	cfg := config.Default()
+	cfg.Root = t.TempDir()
+	cfg.Path = filepath.Join(cfg.Root, ".goreload.yaml")
+	cfg.Files = []string{cfg.Path}
+	cfg.Watch.LocalModules = true
+	e := &Engine{
+		cfg:       cfg,
+		log:       logger.New(logger.Config{Level: "error"}),
+		pauseWake: make(chan struct{}, 1),
+	}
+
+	e.Pause()
+	e.applyPause()
+
+	// Without a builder, a rebuild would panic: both are deferred instead.
+	ctx := context.Background()
+	e.handleConfigChange(ctx, watcher.Event{Path: cfg.Path, Op: watcher.OpWrite})
+	e.handleConfigChange(ctx, watcher.Event{Path: filepath.Join(cfg.Root, "go.mod"), Op: watcher.OpWrite})
+	if !e.pausedConfig {
+		t.Error("pausedConfig = false after a config change while paused")
+	}
+	if !e.pausedModules {
+		t.Error("pausedModules = false after a go.mod change while paused")
+	}
+}
+
+func TestEngine_CheckPauseFile(t *testing.T) {
+	cfg := config.Default()
+	cfg.Root = t.TempDir()
+	e := &Engine{
+		cfg:       cfg,
+		log:       logger.New(logger.Config{Level: "error"}),
+		pauseWake: make(chan struct{}, 1),
+	}
+
+	tmpDir, err := cfg.AbsTmpDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	sentinel := filepath.Join(tmpDir, PauseFile)
+
+	e.checkPauseFile()
+	if e.Paused() {
+		t.Fatal("Paused() = true without the pause file")
+	}
+
+	if err := os.WriteFile(sentinel, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e.checkPauseFile()
+	if !e.Paused() {
+		t.Fatal("Paused() = false with the pause file")
+	}
+
+	// A resume while the file exists is not undone.
+	e.Resume()
+	e.checkPauseFile()
+	if e.Paused() {
+		t.Error("Paused() = true after Resume() with the pause file still present")
+	}
+
+	if err := os.Remove(sentinel); err != nil {
+		t.Fatal(err)
+	}
+	e.Pause()
+	e.checkPauseFile()
+	if e.Paused() {
+		t.Error("Paused() = true after removing the pause file")
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/taro33333/goreload/internal/builder"
+	"github.com/taro33333/goreload/internal/events"
+	"github.com/taro33333/goreload/internal/runner"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// emit writes an event to the event stream, if there is one. A stream that
+// cannot be written to is reported once and then left alone.
+func (e *Engine) emit(typ events.Type, data any) {
+	if err := e.events.Emit(typ, data); err != nil && !e.eventsFailed.Swap(true) {
+		e.log.Error("write event: %v", err)
+	}
+}
+
+// emitWatchStarted reports the directories and files of the current watcher.
+func (e *Engine) emitWatchStarted() {
+	root, _ := e.cfg.AbsRoot()
+	abs := func(paths []string) []string {
+		out := make([]string, 0, len(paths))
+		for _, path := range paths {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+			out = append(out, path)
+		}
+		return out
+	}
+
+	embeds := make([]string, 0, len(e.set.embeds))
+	for _, p := range e.set.embeds {
+		embeds = append(embeds, p.String())
+	}
+
+	e.emit(events.WatchStarted, events.WatchStartedData{
+		Root:    root,
+		Dirs:    abs(e.set.dirs(e.cfg)),
+		Files:   abs(e.cfg.Watch.Files),
+		Embeds:  embeds,
+		Backend: string(e.watcher.Backend()),
+	})
+}
+
+// emitFilesChanged reports the changes of batch.
+func (e *Engine) emitFilesChanged(batch []watcher.Event) {
+	files := make([]events.Change, 0, len(batch))
+	for _, evt := range batch {
+		files = append(files, events.Change{
+			Path: filepath.ToSlash(e.relPath(evt.Path)),
+			Op:   strings.ToLower(evt.Op.String()),
+		})
+	}
+	e.emit(events.FilesChanged, events.FilesChangedData{Files: files})
+}
+
+// emitBuildFinished reports the result of a build.
+func (e *Engine) emitBuildFinished(result builder.Result) {
+	data := events.BuildFinishedData{
+		Success:     result.Success,
+		DurationMS:  result.Duration.Milliseconds(),
+		Diagnostics: result.Diagnostics,
+		Output:      result.Output,
+	}
+	if data.Diagnostics == nil {
+		data.Diagnostics = []builder.Diagnostic{}
+	}
+	if result.Error != nil {
+		data.Error = result.Error.Error()
+	}
+	e.emit(events.BuildFinished, data)
+}
+
+// emitProcessExited is the runner's OnExit callback.
+func (e *Engine) emitProcessExited(exit runner.Exit) {
+	e.emit(events.ProcessExited, events.ProcessExitedData{
+		PID:      exit.PID,
+		ExitCode: exit.Code,
+		Stopped:  exit.Stopped,
+	})
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/logger"
+	"github.com/taro33333/goreload/internal/project"
+)
+
+// gitState holds rebuilds back while a git operation rewrites the working
+// tree, and reports when HEAD moves.
+type gitState struct {
+	repo *project.GitRepo
+
+	// holding is set while events are held back. It is shared with the
+	// watcher's debouncer.
+	holding atomic.Bool
+	// head is the last HEAD seen by the engine loop.
+	head project.GitHead
+}
+
+// newGitState returns the git state of the repository around cfg's root, or
+// nil when there is none or git awareness is disabled.
+func newGitState(cfg *config.Config) *gitState {
+	if !cfg.Watch.Git {
+		return nil
+	}
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return nil
+	}
+	repo, ok := project.FindGit(root)
+	if !ok {
+		return nil
+	}
+
+	g := &gitState{repo: repo}
+	g.head, _ = repo.Head()
+	return g
+}
+
+// hold returns a watcher.Config.Hold function that holds events back while
+// a git operation is in progress, logging when it starts and ends.
+func (g *gitState) hold(log logger.Logger) func() bool {
+	if g == nil {
+		return nil
+	}
+	return func() bool {
+		op, busy := g.repo.Busy()
+		switch {
+		case busy && !g.holding.Swap(true):
+			log.Info("git %s in progress, holding rebuilds", op)
+		case !busy && g.holding.Swap(false):
+			log.Info("git operation finished")
+		}
+		return busy
+	}
+}
+
+// checkHead logs the new branch and commit when HEAD has moved.
+func (g *gitState) checkHead(log logger.Logger) {
+	if g == nil {
+		return
+	}
+	head, err := g.repo.Head()
+	if err != nil || head == g.head {
+		return
+	}
+	g.head = head
+	log.Info("HEAD is now %s", head)
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+const (
+	// loopWindow is how soon after a build a change counts as immediate.
+	loopWindow = 2 * time.Second
+	// loopThreshold is the number of consecutive rebuilds a file must
+	// trigger immediately after the build before a loop is reported.
+	loopThreshold = 3
+)
+
+// buildWindow is the time span of the last build, and started is when the
+// program was last started. Changes made during the build or in the
+// loopWindow after the start are rebuilt like any other, unless they are to a
+// file found to change with every build, such as go generate output or a
+// file the program writes when it starts.
+type buildWindow struct {
+	start, end time.Time
+	started    time.Time
+}
+
+// contains reports whether t is during the build or the program's startup.
+func (w buildWindow) contains(t time.Time) bool {
+	if !w.start.IsZero() && !t.Before(w.start) && !t.After(w.end) {
+		return true
+	}
+	return !w.started.IsZero() && !t.Before(w.started) && !t.After(w.started.Add(loopWindow))
+}
+
+// dropLoopEvents removes the events of batch that happened during the last
+// build or the program's startup to files reported as rebuild loops.
+func (e *Engine) dropLoopEvents(batch []watcher.Event) []watcher.Event {
+	kept := batch[:0]
+	for _, evt := range batch {
+		if e.loops.ignored[evt.Path] && e.build.contains(evt.Time) {
+			e.log.Debug("ignoring %s: changed by the build or the program starting", e.relPath(evt.Path))
+			continue
+		}
+		kept = append(kept, evt)
+	}
+	return kept
+}
+
+// loopDetector finds files that trigger a rebuild immediately after every
+// build, such as files the built program writes into a watched directory.
+type loopDetector struct {
+	// streak counts, per file, the consecutive rebuilds it triggered
+	// immediately after the previous build.
+	streak map[string]int
+	// ignored holds the files reported as loops. Their changes during a
+	// build or the program's startup are attributed to goreload from then
+	// on.
+	ignored map[string]bool
+}
+
+// observe records the batch that triggers a rebuild after a build that ended
+// at end. It returns the files that have now triggered loopThreshold
+// rebuilds in a row; each is returned once per streak.
+func (d *loopDetector) observe(batch []watcher.Event, end time.Time) []string {
+	prev := d.streak
+	d.streak = make(map[string]int)
+
+	var loops []string
+	for _, evt := range batch {
+		if evt.Op == watcher.OpRescan || end.IsZero() || evt.Time.Sub(end) > loopWindow {
+			continue
+		}
+		if _, ok := d.streak[evt.Path]; ok {
+			continue
+		}
+		n := prev[evt.Path] + 1
+		d.streak[evt.Path] = n
+		if n == loopThreshold {
+			loops = append(loops, evt.Path)
+			if d.ignored == nil {
+				d.ignored = make(map[string]bool)
+			}
+			d.ignored[evt.Path] = true
+		}
+	}
+	return loops
+}
+
+// detectLoops warns about files that keep triggering rebuilds right after
+// each build.
+func (e *Engine) detectLoops(batch []watcher.Event) {
+	for _, path := range e.loops.observe(batch, e.build.end) {
+		rel := filepath.ToSlash(e.relPath(path))
+		e.log.Warn("possible rebuild loop on %s: it changes right after every build; its changes during builds and startup are ignored from now on, exclude it with watch.exclude: [%q]", rel, rel)
+	}
+}
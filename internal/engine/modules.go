@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/project"
+)
+
+// localModules returns the directories of the local modules used by the
+// build, leaving out those already inside a watched directory. It returns nil
+// when watch.local_modules is disabled.
+func localModules(cfg *config.Config) ([]string, error) {
+	if !cfg.Watch.LocalModules {
+		return nil, nil
+	}
+
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+	modules, err := project.LocalModules(root)
+	if err != nil {
+		return nil, fmt.Errorf("local modules: %w", err)
+	}
+
+	return slices.DeleteFunc(modules, func(module string) bool {
+		for _, dir := range cfg.Watch.Dirs {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			dir = filepath.Clean(dir)
+			if module == dir || strings.HasPrefix(module, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// configFiles returns the files the config watcher follows: the config files
+// and, when local modules are watched, go.mod and go.work.
+func configFiles(cfg *config.Config) []string {
+	files := slices.Clone(cfg.Files)
+	if cfg.Watch.LocalModules {
+		if root, err := cfg.AbsRoot(); err == nil {
+			files = append(files, project.ModuleFiles(root)...)
+		}
+	}
+	return files
+}
+
+// isModuleFile reports whether path is the go.mod or go.work file that
+// defines the local modules.
+func (e *Engine) isModuleFile(path string) bool {
+	return slices.Contains(configFiles(e.cfg)[len(e.cfg.Files):], path)
+}
+
+// refreshModules re-evaluates the local modules after go.mod or go.work
+// changed, and rebuilds since the dependencies may have changed too. The
+// rebuild also refreshes the dependency scope.
+func (e *Engine) refreshModules(ctx context.Context) {
+	e.updateModules(ctx)
+	if err := e.buildAndRun(ctx); err != nil {
+		e.log.Error("rebuild failed: %v", err)
+	}
+}
+
+// updateModules watches the local modules and config files that go.mod and
+// go.work name now, and marks the packages for a refresh after the next
+// build.
+func (e *Engine) updateModules(ctx context.Context) {
+	modules, err := localModules(e.cfg)
+	switch {
+	case err != nil:
+		e.log.Error("%v (keeping watched modules)", err)
+	case !slices.Equal(modules, e.set.modules):
+		set := e.set
+		set.modules = modules
+		if err := e.replaceWatcher(ctx, e.cfg, set); err != nil {
+			e.log.Error("watch local modules: %v", err)
+		} else {
+			e.logWatchSet()
+			e.emitWatchStarted()
+		}
+	}
+
+	// A go.work file may have been created or removed in a parent directory.
+	if !slices.Equal(configFiles(e.cfg), e.configFiles) {
+		e.replaceConfigWatcher(ctx, e.cfg)
+	}
+
+	e.stale = true
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// PauseFile is the name of the file in tmp_dir whose presence pauses
+// rebuilds.
+const PauseFile = ".goreload-pause"
+
+// pauseFileInterval is how often the presence of PauseFile is checked.
+const pauseFileInterval = 250 * time.Millisecond
+
+// Pause stops acting on changes until Resume is called. The application keeps
+// running, and the changes made meanwhile are rebuilt on resume.
+func (e *Engine) Pause() {
+	e.setPaused(true)
+}
+
+// Resume acts on changes again, rebuilding once if any were made while paused.
+func (e *Engine) Resume() {
+	e.setPaused(false)
+}
+
+// Paused reports whether a pause was requested.
+func (e *Engine) Paused() bool {
+	return e.pauseRequest.Load()
+}
+
+func (e *Engine) setPaused(paused bool) {
+	e.pauseRequest.Store(paused)
+	select {
+	case e.pauseWake <- struct{}{}:
+	default:
+	}
+}
+
+// applyPause moves the run loop to the requested pause state. On resume, it
+// returns the changes collected while paused.
+func (e *Engine) applyPause() []watcher.Event {
+	paused := e.pauseRequest.Load()
+	if paused == e.paused {
+		return nil
+	}
+	e.paused = paused
+
+	if paused {
+		e.log.Info("paused, %s keeps running; changes are rebuilt on resume", e.cfg.Build.Bin)
+		return nil
+	}
+
+	batch := dedupEvents(e.pausedEvents)
+	e.pausedEvents = nil
+	if len(batch) == 0 {
+		if e.pausedConfig || e.pausedModules {
+			e.log.Info("resumed, applying the config changed while paused")
+		} else {
+			e.log.Info("resumed, nothing changed")
+		}
+		return nil
+	}
+	e.log.Info("resumed, %d files changed while paused", len(batch))
+	return batch
+}
+
+// resume applies the config and module changes deferred while paused and
+// rebuilds once for them and batch.
+func (e *Engine) resume(ctx context.Context, batch []watcher.Event) {
+	var c change
+	if e.pausedConfig {
+		e.pausedConfig = false
+		c |= e.applyConfig(ctx)
+	}
+	if e.pausedModules {
+		e.pausedModules = false
+		e.updateModules(ctx)
+		c |= changeBuild
+	}
+
+	switch {
+	case len(batch) > 0:
+		e.handleChanges(ctx, batch)
+	case c.has(changeBuild):
+		if err := e.buildAndRun(ctx); err != nil {
+			e.log.Error("rebuild failed: %v", err)
+		}
+	case c.has(changeRun):
+		if err := e.startProcess(ctx); err != nil {
+			e.log.Error("restart failed: %v", err)
+		}
+	}
+}
+
+// collectPaused keeps batch for the rebuild on resume.
+func (e *Engine) collectPaused(batch []watcher.Event) {
+	e.pausedEvents = append(e.pausedEvents, batch...)
+	e.log.Debug("paused, %d changes pending", len(e.pausedEvents))
+}
+
+// dedupEvents keeps the last event per path, in the order the paths were
+// first changed.
+func dedupEvents(batch []watcher.Event) []watcher.Event {
+	index := make(map[string]int)
+	var out []watcher.Event
+	for _, evt := range batch {
+		if i, ok := index[evt.Path]; ok {
+			out[i] = evt
+			continue
+		}
+		index[evt.Path] = len(out)
+		out = append(out, evt)
+	}
+	return out
+}
+
+// checkPauseFile pauses when PauseFile appears in tmp_dir and resumes when it
+// is removed. Pause and Resume calls in between are left alone.
+func (e *Engine) checkPauseFile() {
+	tmpDir, err := e.cfg.AbsTmpDir()
+	if err != nil {
+		return
+	}
+	_, err = os.Stat(filepath.Join(tmpDir, PauseFile))
+	exists := err == nil
+
+	if exists != e.pauseFile {
+		e.pauseFile = exists
+		e.setPaused(exists)
+	}
+}
@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"slices"
+
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/logger"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// change is a set of engine components affected by a config change.
+type change uint8
+
+const (
+	changeWatch change = 1 << iota
+	changeBuild
+	changeRun
+	changeLog
+	// changeLimits only needs the new config to take effect.
+	changeLimits
+)
+
+func (c change) has(other change) bool {
+	return c&other != 0
+}
+
+// diffConfig reports which components must be recreated to move from old to new.
+func diffConfig(old, new *config.Config) change {
+	var c change
+
+	if old.Root != new.Root {
+		return changeWatch | changeBuild | changeRun | changeLog
+	}
+
+	// The watcher excludes tmp_dir and checks Go files against the build
+	// command's tags, so it follows changes to either.
+	if !reflect.DeepEqual(old.Watch, new.Watch) || old.Build.Delay != new.Build.Delay ||
+		old.TmpDir != new.TmpDir || old.Build.Cmd != new.Build.Cmd {
+		c |= changeWatch
+	}
+	if old.Build.Cmd != new.Build.Cmd || old.Build.Bin != new.Build.Bin || old.TmpDir != new.TmpDir {
+		c |= changeBuild
+	}
+	if old.Build.Bin != new.Build.Bin || old.Build.KillDelay != new.Build.KillDelay ||
+		!reflect.DeepEqual(old.Build.Args, new.Build.Args) {
+		c |= changeRun
+	}
+	if old.Log != new.Log {
+		c |= changeLog
+	}
+	if old.Run != new.Run {
+		c |= changeLimits
+	}
+
+	return c
+}
+
+// handleConfigChange reloads the config or, for go.mod and go.work, the
+// local modules after evt. While paused, that is left to the resume so that
+// the application keeps running.
+func (e *Engine) handleConfigChange(ctx context.Context, evt watcher.Event) {
+	module := e.isModuleFile(evt.Path)
+	if e.paused {
+		e.log.Info("%s changed, applied on resume", e.relPath(evt.Path))
+		if module {
+			e.pausedModules = true
+		} else {
+			e.pausedConfig = true
+		}
+		return
+	}
+
+	if module {
+		e.log.Info("%s changed", e.relPath(evt.Path))
+		e.refreshModules(ctx)
+		return
+	}
+	e.log.Info("%s changed, reloading config", e.relPath(evt.Path))
+	e.reload(ctx)
+}
+
+// reload re-reads the config file and applies the differences to the running
+// engine, rebuilding or restarting the application if they require it.
+func (e *Engine) reload(ctx context.Context) {
+	// Keep the current process unless the build or run settings changed.
+	switch c := e.applyConfig(ctx); {
+	case c.has(changeBuild):
+		if err := e.buildAndRun(ctx); err != nil {
+			e.log.Error("rebuild failed: %v", err)
+		}
+	case c.has(changeRun):
+		if err := e.startProcess(ctx); err != nil {
+			e.log.Error("restart failed: %v", err)
+		}
+	}
+}
+
+// applyConfig re-reads the config file and applies the differences to the
+// engine, except for rebuilding or restarting the application. It returns
+// the components that changed. An invalid config is reported and the current
+// one is kept.
+func (e *Engine) applyConfig(ctx context.Context) change {
+	cfg, err := config.LoadProfile(e.cfg.Path, e.cfg.Profile)
+	if err != nil {
+		e.log.Error("reload config: %v (keeping current config)", err)
+		return 0
+	}
+
+	c := diffConfig(e.cfg, cfg)
+	if c == 0 {
+		if !slices.Equal(e.configFiles, configFiles(cfg)) {
+			e.replaceConfigWatcher(ctx, cfg)
+			e.cfg = cfg
+		}
+		e.log.Info("config unchanged")
+		return 0
+	}
+
+	b, err := newBuilder(cfg)
+	if err != nil {
+		e.log.Error("reload builder: %v (keeping current config)", err)
+		return 0
+	}
+	r, err := e.newRunner(cfg)
+	if err != nil {
+		e.log.Error("reload runner: %v (keeping current config)", err)
+		return 0
+	}
+
+	if c.has(changeWatch) {
+		set, err := resolveWatchSet(ctx, cfg)
+		if err != nil {
+			e.log.Warn("%v", err)
+		}
+		if err := e.replaceWatcher(ctx, cfg, set); err != nil {
+			e.log.Error("reload watcher: %v (keeping current config)", err)
+			return 0
+		}
+	}
+
+	// Follow files added to or removed from "extends".
+	if !slices.Equal(e.configFiles, configFiles(cfg)) {
+		e.replaceConfigWatcher(ctx, cfg)
+	}
+
+	if c.has(changeLog) {
+		e.log.SetLevel(logger.ParseLevel(cfg.Log.Level))
+		e.log.SetColor(cfg.Log.Color)
+		e.log.SetTime(cfg.Log.Time)
+	}
+
+	if c.has(changeRun) {
+		e.stopProcess(ctx)
+		e.mu.Lock()
+		e.runner = r
+		e.mu.Unlock()
+	}
+	if c.has(changeBuild) {
+		e.builder = b
+		// A new build command may build other packages.
+		e.stale = true
+	}
+
+	e.cfg = cfg
+	e.log.Info("config reloaded")
+	if c.has(changeWatch) {
+		e.logWatchSettings()
+		e.emitWatchStarted()
+	}
+	return c
+}
+
+// replaceWatcher starts a watcher for cfg and the directories in set and
+// swaps it in for the current one. Changes the old watcher had not delivered
+// yet are carried over to the run loop.
+func (e *Engine) replaceWatcher(ctx context.Context, cfg *config.Config, set watchSet) error {
+	// Keep the backend the current watcher settled on, so that "auto" does
+	// not probe again.
+	backend := e.watcher.Backend()
+	if cfg.Watch.Backend != e.cfg.Watch.Backend {
+		backend = watcher.Backend(cfg.Watch.Backend)
+	}
+
+	w, err := newWatcher(cfg, set, backend, e.log)
+	if err != nil {
+		return err
+	}
+	if err := e.startWatcher(ctx, w); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	e.mu.Lock()
+	old := e.watcher
+	e.watcher = w
+	e.set = set
+	e.reported = watcher.Stats{}
+	e.mu.Unlock()
+
+	_ = old.Close()
+	e.carried = append(e.carried, pendingEvents(old.Events())...)
+	return nil
+}
+
+// pendingEvents returns the events queued in events without waiting for more.
+func pendingEvents(events <-chan watcher.Event) []watcher.Event {
+	var batch []watcher.Event
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, evt)
+		default:
+			return batch
+		}
+	}
+}
+
+// replaceConfigWatcher watches the config files of cfg instead of the current ones.
+func (e *Engine) replaceConfigWatcher(ctx context.Context, cfg *config.Config) {
+	files := configFiles(cfg)
+	w, err := newConfigWatcher(files, cfg, e.watcher.Backend())
+	if err == nil {
+		if err = w.Start(ctx); err != nil {
+			_ = w.Close()
+		}
+	}
+	if err != nil {
+		e.log.Warn("config reload disabled: %v", err)
+		w = nil
+		files = nil
+	}
+
+	e.mu.Lock()
+	old := e.configWatcher
+	e.configWatcher = w
+	e.configFiles = files
+	e.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+	}
+}
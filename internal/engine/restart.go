@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// restartLimiter enforces run.min_restart_interval and
+// run.max_restarts_per_minute on the starts of the application. Builds that
+// fail do not start it and do not count.
+type restartLimiter struct {
+	// starts holds the starts of the last minute, oldest first.
+	starts []time.Time
+}
+
+// record records a start of the application at now.
+func (l *restartLimiter) record(now time.Time) {
+	l.trim(now)
+	l.starts = append(l.starts, now)
+}
+
+// allow reports whether a restart at now is within the limits of cfg. When
+// it is not, reason says which limit was hit.
+func (l *restartLimiter) allow(cfg config.RunConfig, now time.Time) (ok bool, reason string) {
+	l.trim(now)
+
+	if n := len(l.starts); n > 0 && cfg.MinRestartInterval > 0 {
+		if since := now.Sub(l.starts[n-1]); since < cfg.MinRestartInterval {
+			return false, fmt.Sprintf("restarted %s after the previous restart, run.min_restart_interval is %s",
+				since.Round(time.Millisecond), cfg.MinRestartInterval)
+		}
+	}
+	if cfg.MaxRestartsPerMinute > 0 && len(l.starts) >= cfg.MaxRestartsPerMinute {
+		return false, fmt.Sprintf("%d restarts in the last minute, run.max_restarts_per_minute is %d",
+			len(l.starts), cfg.MaxRestartsPerMinute)
+	}
+	return true, ""
+}
+
+// trim forgets the starts older than a minute.
+func (l *restartLimiter) trim(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	for len(l.starts) > 0 && !l.starts[0].After(cutoff) {
+		l.starts = l.starts[1:]
+	}
+}
+
+// reset forgets the recorded starts.
+func (l *restartLimiter) reset() {
+	l.starts = nil
+}
+
+// pauseCrashLoop stops the application and pauses rebuilds until the next
+// change.
+func (e *Engine) pauseCrashLoop(ctx context.Context, reason string) {
+	e.stopProcess(ctx)
+	e.crashLoop = time.Now()
+	e.log.Error("crash loop detected — save a file to retry (%s)", reason)
+}
+
+// retryCrashLoop reports whether batch may trigger a rebuild. While paused
+// after a crash loop, only changes made after the pause do, such as the
+// user saving a file; the restarts that follow get a fresh allowance.
+func (e *Engine) retryCrashLoop(batch []watcher.Event) bool {
+	if e.crashLoop.IsZero() {
+		return true
+	}
+	for _, evt := range batch {
+		if evt.Time.After(e.crashLoop) {
+			e.crashLoop = time.Time{}
+			e.restarts.reset()
+			e.log.Info("retrying after crash loop")
+			return true
+		}
+	}
+	e.log.Debug("ignoring %d changes made before the crash loop pause", len(batch))
+	return false
+}
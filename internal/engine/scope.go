@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/taro33333/goreload/internal/builder"
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/project"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// depsTimeout bounds a "go list" run for the dependency scope and embedded
+// files.
+const depsTimeout = 30 * time.Second
+
+// watchSet holds the directories that are watched besides, or with the
+// "deps" scope instead of, the configured ones.
+type watchSet struct {
+	// modules are the local module directories watched alongside
+	// cfg.Watch.Dirs.
+	modules []string
+	// deps are the package directories of the build target, each watched
+	// without its subdirectories. It is empty unless the scope is "deps".
+	deps []string
+	// embeds are the //go:embed patterns of the build target. The files
+	// they match are watched whatever the filter says.
+	embeds []watcher.EmbedPattern
+	// constraints is the build environment that changes to Go files are
+	// checked against, nil when build constraints are not applied.
+	constraints *watcher.BuildConstraints
+	// git follows the repository around the root, nil when there is none.
+	git *gitState
+}
+
+// dirs returns the directories to watch.
+func (s watchSet) dirs(cfg *config.Config) []string {
+	if len(s.deps) > 0 {
+		return s.deps
+	}
+	return append(slices.Clone(cfg.Watch.Dirs), s.modules...)
+}
+
+// flat reports whether the directories are watched without subdirectories.
+func (s watchSet) flat() bool {
+	return len(s.deps) > 0
+}
+
+// resolveWatchSet finds the local modules, the embedded files, the build
+// environment, the git repository and, with the "deps" scope, the package
+// directories for cfg. Whatever could be resolved
+// is returned along with any errors.
+func resolveWatchSet(ctx context.Context, cfg *config.Config) (watchSet, error) {
+	var set watchSet
+	var errs []error
+
+	modules, err := localModules(cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	set.modules = modules
+
+	pkgs, err := listPackages(ctx, cfg)
+	if err != nil {
+		if cfg.Watch.Scope == config.ScopeDeps {
+			errs = append(errs, fmt.Errorf("%w (watching all directories)", err))
+		} else {
+			errs = append(errs, fmt.Errorf("%w (embedded files are not watched)", err))
+		}
+	}
+	set.setPackages(cfg, pkgs)
+
+	constraints, err := buildConstraints(ctx, cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	set.constraints = constraints
+	set.git = newGitState(cfg)
+
+	return set, errors.Join(errs...)
+}
+
+// setPackages takes the parts of pkgs that cfg asks for.
+func (s *watchSet) setPackages(cfg *config.Config, pkgs project.Packages) {
+	s.deps, s.embeds = nil, nil
+	if cfg.Watch.Scope == config.ScopeDeps {
+		s.deps = pkgs.Dirs
+	}
+	if cfg.Watch.Embeds {
+		for _, p := range pkgs.EmbedPatterns {
+			s.embeds = append(s.embeds, watcher.EmbedPattern{Dir: p.Dir, Pattern: p.Pattern})
+		}
+	}
+}
+
+// listPackages lists the packages the build target depends on. It returns
+// nothing unless the scope is "deps" or embedded files are watched. Embedded
+// files are only found for "go build" commands; other commands are skipped
+// silently unless the scope needs them.
+func listPackages(ctx context.Context, cfg *config.Config) (project.Packages, error) {
+	deps := cfg.Watch.Scope == config.ScopeDeps
+	if !deps && !cfg.Watch.Embeds {
+		return project.Packages{}, nil
+	}
+
+	gb, ok := builder.ParseGoBuild(cfg.Build.Cmd)
+	if !ok {
+		if !deps {
+			return project.Packages{}, nil
+		}
+		return project.Packages{}, fmt.Errorf("scope %q needs a \"go build\" command", config.ScopeDeps)
+	}
+
+	root, err := cfg.AbsRoot()
+	if err != nil {
+		return project.Packages{}, fmt.Errorf("resolve root: %w", err)
+	}
+	dir := root
+	if gb.Dir != "" {
+		dir = filepath.Join(root, gb.Dir)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, depsTimeout)
+	defer cancel()
+	return project.ListPackages(ctx, dir, gb.Packages, gb.Tags)
+}
+
+// touchesPackages reports whether batch changes a Go file or go.mod, which
+// may add or remove imports and embedded files.
+func touchesPackages(batch []watcher.Event) bool {
+	for _, evt := range batch {
+		if filepath.Ext(evt.Path) == ".go" || filepath.Base(evt.Path) == "go.mod" {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshPackages lists the build target's packages again, after a build
+// that may have added or removed imports or embedded files, and watches the
+// new set.
+func (e *Engine) refreshPackages(ctx context.Context) {
+	if e.cfg.Watch.Scope != config.ScopeDeps && !e.cfg.Watch.Embeds {
+		return
+	}
+
+	pkgs, err := listPackages(ctx, e.cfg)
+	if err != nil {
+		e.log.Warn("%v (keeping watched packages)", err)
+		return
+	}
+	set := e.set
+	set.setPackages(e.cfg, pkgs)
+	depsChanged := !slices.Equal(set.deps, e.set.deps)
+	embedsChanged := !slices.Equal(set.embeds, e.set.embeds)
+	if !depsChanged && !embedsChanged {
+		return
+	}
+
+	if err := e.replaceWatcher(ctx, e.cfg, set); err != nil {
+		e.log.Error("watch dependencies: %v", err)
+		return
+	}
+	if depsChanged {
+		e.log.Info("dependencies changed, watching %d packages", len(set.deps))
+	}
+	if embedsChanged {
+		e.log.Info("embed patterns changed, watching %d patterns", len(set.embeds))
+	}
+	e.emitWatchStarted()
+}
+
+// logWatchSet logs the directories and files watched besides the configured
+// ones.
+func (e *Engine) logWatchSet() {
+	if e.set.constraints != nil {
+		e.log.Debug("build constraints: %s", e.set.constraints)
+	}
+	if len(e.set.embeds) > 0 {
+		e.log.Info("watching files for %d embed patterns", len(e.set.embeds))
+		for _, p := range e.set.embeds {
+			e.log.Debug("watching embedded files: %s", e.relPath(p.String()))
+		}
+	}
+	if e.set.flat() {
+		e.log.Info("watching %d packages the build depends on", len(e.set.deps))
+		for _, dir := range e.set.deps {
+			e.log.Debug("watching package: %s", dir)
+		}
+		return
+	}
+	for _, dir := range e.set.modules {
+		e.log.Info("watching local module: %s", dir)
+	}
+}
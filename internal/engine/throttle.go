@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/taro33333/goreload/internal/config"
+	"github.com/taro33333/goreload/internal/watcher"
+)
+
+// debounceDelay returns the watcher's debounce delay: watch.debounce.delay,
+// or build.delay when it is not set.
+func debounceDelay(cfg *config.Config) time.Duration {
+	if cfg.Watch.Debounce.Delay > 0 {
+		return cfg.Watch.Debounce.Delay
+	}
+	return cfg.Build.Delay
+}
+
+// throttleDelay returns how long a rebuild requested at now must wait to
+// start no sooner than watch.debounce.throttle after the last build ended,
+// and, with adaptive debouncing, no sooner than the last build took.
+func throttleDelay(cfg config.DebounceConfig, last buildWindow, now time.Time) time.Duration {
+	if last.end.IsZero() {
+		return 0
+	}
+	interval := cfg.Throttle
+	if cfg.Adaptive {
+		interval = max(interval, last.end.Sub(last.start))
+	}
+	return max(last.end.Add(interval).Sub(now), 0)
+}
+
+// throttle waits out throttleDelay, adding the changes that arrive meanwhile
+// to batch. It returns nil when ctx is done.
+func (e *Engine) throttle(ctx context.Context, batch []watcher.Event) []watcher.Event {
+	wait := throttleDelay(e.cfg.Watch.Debounce, e.build, time.Now())
+	if wait <= 0 {
+		return batch
+	}
+	e.log.Debug("throttling rebuild for %s", wait.Round(time.Millisecond))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			return batch
+		case evt, ok := <-e.watcher.Events():
+			if !ok {
+				return batch
+			}
+			batch = append(batch, evt)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package events writes goreload's lifecycle events as newline-delimited
+// JSON, for editors and scripts that react to builds.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/taro33333/goreload/internal/builder"
+)
+
+// SchemaVersion is written with every event. It changes only when a field
+// is removed or changes meaning; new event types and fields may be added
+// without changing it.
+const SchemaVersion = 1
+
+// Type identifies an event.
+type Type string
+
+// Event types, in the order they typically occur.
+const (
+	WatchStarted   Type = "watch_started"
+	FilesChanged   Type = "files_changed"
+	BuildStarted   Type = "build_started"
+	BuildFinished  Type = "build_finished"
+	ProcessStarted Type = "process_started"
+	ProcessExited  Type = "process_exited"
+	Ready          Type = "ready"
+	Shutdown       Type = "shutdown"
+)
+
+// WatchStartedData describes what is being watched.
+type WatchStartedData struct {
+	Root    string   `json:"root"`
+	Dirs    []string `json:"dirs"`
+	Files   []string `json:"files"`
+	Embeds  []string `json:"embeds"`
+	Backend string   `json:"backend"`
+}
+
+// FilesChangedData lists the changes that trigger a rebuild.
+type FilesChangedData struct {
+	Files []Change `json:"files"`
+}
+
+// Change is a changed file. Path is relative to the project root, with "/"
+// separators, and Op is "create", "write", "remove", "rename", "chmod" or
+// "rescan".
+type Change struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+}
+
+// BuildStartedData holds the build command being run.
+type BuildStartedData struct {
+	Command string `json:"command"`
+}
+
+// BuildFinishedData holds the result of a build. Diagnostics is empty, not
+// absent, when there are none.
+type BuildFinishedData struct {
+	Success     bool                 `json:"success"`
+	DurationMS  int64                `json:"duration_ms"`
+	Diagnostics []builder.Diagnostic `json:"diagnostics"`
+	Output      string               `json:"output"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// ProcessStartedData describes a started application process.
+type ProcessStartedData struct {
+	PID int    `json:"pid"`
+	Bin string `json:"bin"`
+}
+
+// ProcessExitedData describes how the application process ended. ExitCode is
+// -1 when it was ended by a signal, and Stopped is true when goreload ended it.
+type ProcessExitedData struct {
+	PID      int  `json:"pid"`
+	ExitCode int  `json:"exit_code"`
+	Stopped  bool `json:"stopped"`
+}
+
+// ReadyData is sent once a rebuild cycle is over and goreload waits for
+// changes. Running reports whether the application is running.
+type ReadyData struct {
+	Running bool `json:"running"`
+}
+
+// Stream writes events to an io.Writer, one JSON object per line. A nil
+// *Stream discards events.
+type Stream struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewStream returns a Stream writing to w.
+func NewStream(w io.Writer) *Stream {
+	return &Stream{w: w, now: time.Now}
+}
+
+// Emit writes an event of type typ. The fields of data, a struct or nil,
+// follow the "schema", "time" and "type" fields on the same line.
+func (s *Stream) Emit(typ Type, data any) error {
+	if s == nil {
+		return nil
+	}
+
+	header, err := json.Marshal(struct {
+		Schema int       `json:"schema"`
+		Time   time.Time `json:"time"`
+		Type   Type      `json:"type"`
+	}{SchemaVersion, s.now().UTC(), typ})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header[:len(header)-1])
+	if data != nil {
+		fields, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if len(fields) > 2 {
+			buf.WriteByte(',')
+			buf.Write(fields[1 : len(fields)-1])
+		}
+	}
+	buf.WriteString("}\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(buf.Bytes())
+	return err
+}
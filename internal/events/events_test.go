@@ -0,0 +1,62 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taro33333/goreload/internal/builder"
+)
+
+func TestStream_Emit(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStream(&buf)
+	s.now = func() time.Time {
+		return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	if err := s.Emit(BuildStarted, BuildStartedData{Command: "go build -o ./tmp/main ."}); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	if err := s.Emit(BuildFinished, BuildFinishedData{
+		Success:     false,
+		DurationMS:  1234,
+		Diagnostics: []builder.Diagnostic{{File: "main.go", Line: 5, Column: 2, Message: "undefined: foo"}},
+		Output:      "./main.go:5:2: undefined: foo\n",
+		Error:       "build failed: exit status 1",
+	}); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	if err := s.Emit(Shutdown, nil); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+
+	want := []string{
+		`{"schema":1,"time":"2024-05-01T12:00:00Z","type":"build_started","command":"go build -o ./tmp/main ."}`,
+		`{"schema":1,"time":"2024-05-01T12:00:00Z","type":"build_finished","success":false,"duration_ms":1234,` +
+			`"diagnostics":[{"file":"main.go","line":5,"column":2,"message":"undefined: foo"}],` +
+			`"output":"./main.go:5:2: undefined: foo\n","error":"build failed: exit status 1"}`,
+		`{"schema":1,"time":"2024-05-01T12:00:00Z","type":"shutdown"}`,
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("wrote %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %s\nwant %s", i+1, got[i], want[i])
+		}
+		if !json.Valid([]byte(got[i])) {
+			t.Errorf("line %d is not valid JSON: %s", i+1, got[i])
+		}
+	}
+}
+
+func TestStream_EmitNil(t *testing.T) {
+	var s *Stream
+	if err := s.Emit(Ready, ReadyData{Running: true}); err != nil {
+		t.Errorf("Emit() on a nil stream error = %v", err)
+	}
+}
@@ -32,6 +32,10 @@ type Logger interface {
 	SetOutput(w io.Writer)
 	// SetLevel changes the minimum log level.
 	SetLevel(level Level)
+	// SetColor turns colored output on or off.
+	SetColor(enabled bool)
+	// SetTime turns timestamps on or off.
+	SetTime(enabled bool)
 }
 
 // Config holds logger configuration.
@@ -119,6 +123,19 @@ func (l *logger) SetLevel(level Level) {
 	l.level = level
 }
 
+func (l *logger) SetColor(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.useColor = enabled
+	l.initColors()
+}
+
+func (l *logger) SetTime(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.showTime = enabled
+}
+
 func (l *logger) Debug(msg string, args ...any) {
 	if l.level > LevelDebug {
 		return
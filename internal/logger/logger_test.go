@@ -165,6 +165,30 @@ func TestLogger_SetLevel(t *testing.T) {
 	}
 }
 
+func TestLogger_SetTime(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := New(Config{
+		Color: false,
+		Time:  false,
+		Level: "info",
+	})
+	l.SetOutput(&buf)
+
+	l.Info("without time")
+	if !strings.HasPrefix(buf.String(), "[INFO]") {
+		t.Errorf("Output should start with [INFO], got: %v", buf.String())
+	}
+
+	l.SetTime(true)
+
+	buf.Reset()
+	l.Info("with time")
+	if strings.HasPrefix(buf.String(), "[INFO]") {
+		t.Errorf("Output should start with a timestamp after SetTime(true), got: %v", buf.String())
+	}
+}
+
 func TestLogger_WithTime(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -0,0 +1,94 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// listPackage holds the fields of "go list -json" used by ListPackages.
+type listPackage struct {
+	Dir           string
+	Standard      bool
+	EmbedPatterns []string
+	Module        *struct {
+		Main    bool
+		Replace *struct {
+			Version string
+		}
+	}
+}
+
+// Packages describes the local packages a build depends on.
+type Packages struct {
+	// Dirs are the package directories.
+	Dirs []string
+	// EmbedPatterns are the patterns of the //go:embed directives.
+	EmbedPatterns []EmbedPattern
+}
+
+// EmbedPattern is a //go:embed pattern of a package.
+type EmbedPattern struct {
+	// Dir is the package directory the pattern is relative to.
+	Dir string
+	// Pattern is the pattern as written, including any "all:" prefix.
+	Pattern string
+}
+
+// ListPackages runs "go list -deps" in dir for the given package patterns and
+// build tags, and describes the packages they depend on that belong to the
+// main module, a workspace module or a module replaced by a local directory.
+// Standard library and downloaded packages are left out.
+func ListPackages(ctx context.Context, dir string, patterns, tags []string) (Packages, error) {
+	args := []string{"list", "-e", "-deps", "-json=Dir,Standard,EmbedPatterns,Module"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	args = append(args, patterns...)
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Packages{}, fmt.Errorf("go list: %w: %s", err, msg)
+		}
+		return Packages{}, fmt.Errorf("go list: %w", err)
+	}
+
+	var pkgs Packages
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg listPackage
+		if err := dec.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return Packages{}, fmt.Errorf("decode go list output: %w", err)
+		}
+
+		if pkg.Standard || pkg.Dir == "" || pkg.Module == nil {
+			continue
+		}
+		local := pkg.Module.Replace != nil && pkg.Module.Replace.Version == ""
+		if !pkg.Module.Main && !local {
+			continue
+		}
+		pkgs.Dirs = append(pkgs.Dirs, pkg.Dir)
+		for _, pattern := range pkg.EmbedPatterns {
+			pkgs.EmbedPatterns = append(pkgs.EmbedPatterns, EmbedPattern{Dir: pkg.Dir, Pattern: pattern})
+		}
+	}
+
+	slices.Sort(pkgs.Dirs)
+	pkgs.Dirs = slices.Compact(pkgs.Dirs)
+	return pkgs, nil
+}
@@ -0,0 +1,34 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GoEnv runs "go env" in dir and returns the values of the named variables,
+// as the go command sees them with the environment and the go env file.
+func GoEnv(ctx context.Context, dir string, names ...string) (map[string]string, error) {
+	args := append([]string{"env", "-json"}, names...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("go env: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+
+	env := make(map[string]string)
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, fmt.Errorf("decode go env output: %w", err)
+	}
+	return env, nil
+}
@@ -0,0 +1,143 @@
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitRepo is the git repository a directory belongs to.
+type GitRepo struct {
+	// Dir is the git directory: ".git", or the directory of a linked
+	// worktree below ".git/worktrees".
+	Dir string
+	// CommonDir holds the refs shared by all worktrees. Outside linked
+	// worktrees it is Dir.
+	CommonDir string
+}
+
+// GitHead describes the commit checked out in a repository.
+type GitHead struct {
+	// Branch is empty when HEAD is detached.
+	Branch string
+	Commit string
+}
+
+func (h GitHead) String() string {
+	commit := h.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if h.Branch == "" {
+		return "detached at " + commit
+	}
+	if commit == "" {
+		return h.Branch
+	}
+	return h.Branch + " at " + commit
+}
+
+// gitOps maps the files git keeps while an operation is in progress to the
+// operation's name. They are checked in order.
+var gitOps = []struct {
+	file, op string
+}{
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase"},
+	{"MERGE_HEAD", "merge"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"index.lock", "checkout"},
+}
+
+// FindGit returns the repository that dir belongs to, searching dir and its
+// parents for ".git".
+func FindGit(dir string) (*GitRepo, bool) {
+	for {
+		path := filepath.Join(dir, ".git")
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				return &GitRepo{Dir: path, CommonDir: path}, true
+			}
+			return readGitFile(dir, path)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, false
+		}
+		dir = parent
+	}
+}
+
+// readGitFile follows the "gitdir:" line of a linked worktree's .git file.
+func readGitFile(dir, path string) (*GitRepo, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return nil, false
+	}
+	repo := &GitRepo{Dir: resolveDir(dir, strings.TrimSpace(gitDir))}
+	repo.CommonDir = repo.Dir
+	if data, err := os.ReadFile(filepath.Join(repo.Dir, "commondir")); err == nil {
+		repo.CommonDir = resolveDir(repo.Dir, strings.TrimSpace(string(data)))
+	}
+	return repo, true
+}
+
+// Busy reports whether a git operation that rewrites the working tree is in
+// progress, and names it.
+func (r *GitRepo) Busy() (string, bool) {
+	for _, op := range gitOps {
+		if _, err := os.Stat(filepath.Join(r.Dir, op.file)); err == nil {
+			return op.op, true
+		}
+	}
+	return "", false
+}
+
+// Head reads the branch and commit checked out.
+func (r *GitRepo) Head() (GitHead, error) {
+	data, err := os.ReadFile(filepath.Join(r.Dir, "HEAD"))
+	if err != nil {
+		return GitHead{}, err
+	}
+	head := strings.TrimSpace(string(data))
+
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		return GitHead{Commit: head}, nil
+	}
+	return GitHead{
+		Branch: strings.TrimPrefix(ref, "refs/heads/"),
+		Commit: r.resolveRef(ref),
+	}, nil
+}
+
+// resolveRef returns the commit ref points to, from a loose ref file or
+// packed-refs. It is empty for a branch without commits.
+func (r *GitRepo) resolveRef(ref string) string {
+	for _, dir := range []string{r.Dir, r.CommonDir} {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		commit, name, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == ref {
+			return commit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,282 @@
+// Package project inspects Go modules and workspaces for goreload.
+package project
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Info describes the Go module or workspace rooted at a directory.
+type Info struct {
+	// Root is the absolute directory that was inspected.
+	Root string
+	// Module is the module path declared in Root/go.mod, if any.
+	Module string
+	// WorkFile is the absolute path of Root/go.work, if it exists.
+	WorkFile string
+	// WorkModules are the absolute directories listed in go.work "use" directives.
+	WorkModules []string
+	// Mains are the directories containing a main package, relative to Root
+	// and using forward slashes ("." for Root itself).
+	Mains []string
+}
+
+// Inspect reads go.mod and go.work in root and finds the main packages that
+// can be built from it. Nested modules are only searched when they are part
+// of the workspace.
+func Inspect(root string) (*Info, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+
+	info := &Info{Root: root}
+
+	if data, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+		info.Module = modfile.ModulePath(data)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read go.mod: %w", err)
+	}
+
+	workFile := filepath.Join(root, "go.work")
+	if _, err := os.Stat(workFile); err == nil {
+		info.WorkFile = workFile
+		if info.WorkModules, err = ParseWork(workFile); err != nil {
+			return nil, err
+		}
+	}
+
+	info.Mains, err = findMains(root, info.WorkModules)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ParseWork returns the absolute module directories used by a go.work file.
+func ParseWork(path string) ([]string, error) {
+	wf, err := readWork(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	dirs := make([]string, 0, len(wf.Use))
+	for _, use := range wf.Use {
+		dirs = append(dirs, resolveDir(dir, use.Path))
+	}
+	return dirs, nil
+}
+
+func readWork(path string) (*modfile.WorkFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read go.work: %w", err)
+	}
+
+	wf, err := modfile.ParseWork(path, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parse go.work: %w", err)
+	}
+	return wf, nil
+}
+
+// resolveDir makes a directory path from a go.mod or go.work file absolute.
+func resolveDir(base, path string) string {
+	d := filepath.FromSlash(path)
+	if !filepath.IsAbs(d) {
+		d = filepath.Join(base, d)
+	}
+	return filepath.Clean(d)
+}
+
+// FindWork returns the go.work file the go command uses for root: the file
+// named by GOWORK, or the first go.work in root or one of its parents. It
+// returns "" when there is none or GOWORK=off.
+func FindWork(root string) string {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+	default:
+		if !filepath.IsAbs(gowork) {
+			return ""
+		}
+		return gowork
+	}
+
+	for dir := root; ; {
+		path := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ModuleFiles returns the files that define the local modules of root: its
+// go.mod and the go.work file in use, or root/go.work when there is none so
+// that creating one can be noticed.
+func ModuleFiles(root string) []string {
+	work := FindWork(root)
+	if work == "" {
+		work = filepath.Join(root, "go.work")
+	}
+	return []string{filepath.Join(root, "go.mod"), work}
+}
+
+// LocalModules returns the absolute directories of the modules that a build
+// in root uses from the local file system: directory replacements in
+// root/go.mod, and the modules and directory replacements of the go.work
+// file in use. Root itself is not included.
+func LocalModules(root string) ([]string, error) {
+	var dirs []string
+
+	modPath := filepath.Join(root, "go.mod")
+	if data, err := os.ReadFile(modPath); err == nil {
+		mf, err := modfile.Parse(modPath, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse go.mod: %w", err)
+		}
+		dirs = append(dirs, replaceDirs(root, mf.Replace)...)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read go.mod: %w", err)
+	}
+
+	if work := FindWork(root); work != "" {
+		wf, err := readWork(work)
+		if err != nil {
+			return nil, err
+		}
+		base := filepath.Dir(work)
+		for _, use := range wf.Use {
+			dirs = append(dirs, resolveDir(base, use.Path))
+		}
+		dirs = append(dirs, replaceDirs(base, wf.Replace)...)
+	}
+
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+	return slices.DeleteFunc(dirs, func(dir string) bool { return dir == root }), nil
+}
+
+// replaceDirs returns the directories that replace directives point to.
+func replaceDirs(base string, replaces []*modfile.Replace) []string {
+	var dirs []string
+	for _, r := range replaces {
+		if r.New.Version == "" && modfile.IsDirectoryPath(r.New.Path) {
+			dirs = append(dirs, resolveDir(base, r.New.Path))
+		}
+	}
+	return dirs
+}
+
+// skipDir reports whether a directory is never searched for packages.
+func skipDir(name string) bool {
+	switch name {
+	case "vendor", "testdata", "node_modules":
+		return true
+	}
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+func findMains(root string, workModules []string) ([]string, error) {
+	var mains []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			if skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			// A nested module is a separate build unless the workspace uses it.
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && !slices.Contains(workModules, path) {
+				return filepath.SkipDir
+			}
+		}
+
+		if isMainPackage(path) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			mains = append(mains, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find main packages: %w", err)
+	}
+
+	return mains, nil
+}
+
+// isMainPackage reports whether dir holds non-test Go files in package main.
+func isMainPackage(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		return f.Name.Name == "main"
+	}
+	return false
+}
+
+// EnsureGitignore appends entry to root/.gitignore, creating the file if
+// needed. It reports whether the file was changed; an entry that is already
+// present, with or without leading or trailing slashes, is left alone.
+func EnsureGitignore(root, entry string) (bool, error) {
+	path := filepath.Join(root, ".gitignore")
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("read .gitignore: %w", err)
+	}
+
+	want := strings.Trim(entry, "/")
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.Trim(strings.TrimSpace(line), "/") == want {
+			return false, nil
+		}
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "/" + want + "/\n"
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("write .gitignore: %w", err)
+	}
+	return true, nil
+}
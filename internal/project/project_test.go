@@ -0,0 +1,309 @@
+package project
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile(t, filepath.Join(root, "go.mod"), "module example.com/app\n\ngo 1.22\n")
+	writeFile(t, filepath.Join(root, "cmd", "api", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "cmd", "worker", "main.go"), "// Worker entry point.\npackage main\n")
+	writeFile(t, filepath.Join(root, "internal", "lib", "lib.go"), "package lib\n")
+	writeFile(t, filepath.Join(root, "internal", "lib", "main_test.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "vendor", "x", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "testdata", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "tools", "go.mod"), "module example.com/tools\n")
+	writeFile(t, filepath.Join(root, "tools", "gen", "main.go"), "package main\n")
+
+	info, err := Inspect(root)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+
+	if info.Module != "example.com/app" {
+		t.Errorf("Module = %v, want example.com/app", info.Module)
+	}
+	if info.WorkFile != "" {
+		t.Errorf("WorkFile = %v, want empty", info.WorkFile)
+	}
+	want := []string{"cmd/api", "cmd/worker"}
+	if !slices.Equal(info.Mains, want) {
+		t.Errorf("Mains = %v, want %v", info.Mains, want)
+	}
+
+	t.Run("workspace", func(t *testing.T) {
+		writeFile(t, filepath.Join(root, "go.work"), "go 1.22\n\nuse (\n\t.\n\t./tools\n)\n")
+
+		info, err := Inspect(root)
+		if err != nil {
+			t.Fatalf("Inspect() error = %v", err)
+		}
+		if info.WorkFile != filepath.Join(root, "go.work") {
+			t.Errorf("WorkFile = %v", info.WorkFile)
+		}
+		wantModules := []string{root, filepath.Join(root, "tools")}
+		if !slices.Equal(info.WorkModules, wantModules) {
+			t.Errorf("WorkModules = %v, want %v", info.WorkModules, wantModules)
+		}
+		want := []string{"cmd/api", "cmd/worker", "tools/gen"}
+		if !slices.Equal(info.Mains, want) {
+			t.Errorf("Mains = %v, want %v", info.Mains, want)
+		}
+	})
+}
+
+func TestEnsureGitignore(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, ".gitignore")
+
+	added, err := EnsureGitignore(root, "tmp")
+	if err != nil {
+		t.Fatalf("EnsureGitignore() error = %v", err)
+	}
+	if !added {
+		t.Error("EnsureGitignore() = false for missing .gitignore")
+	}
+
+	writeFile(t, path, "*.log\ntmp/")
+	added, err = EnsureGitignore(root, "tmp")
+	if err != nil {
+		t.Fatalf("EnsureGitignore() error = %v", err)
+	}
+	if added {
+		t.Error("EnsureGitignore() = true for existing entry")
+	}
+
+	added, err = EnsureGitignore(root, "build")
+	if err != nil {
+		t.Fatalf("EnsureGitignore() error = %v", err)
+	}
+	if !added {
+		t.Error("EnsureGitignore() = false for new entry")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read .gitignore: %v", err)
+	}
+	if got, want := string(data), "*.log\ntmp/\n/build/\n"; got != want {
+		t.Errorf(".gitignore = %q, want %q", got, want)
+	}
+}
+
+func TestLocalModules(t *testing.T) {
+	t.Setenv("GOWORK", "")
+	base := t.TempDir()
+	root := filepath.Join(base, "app")
+
+	writeFile(t, filepath.Join(root, "go.mod"), `module example.com/app
+
+go 1.22
+
+require (
+	example.com/lib v1.0.0
+	example.com/remote v1.0.0
+)
+
+replace example.com/lib => ../lib
+
+replace example.com/remote => example.com/fork v1.2.0
+`)
+
+	modules, err := LocalModules(root)
+	if err != nil {
+		t.Fatalf("LocalModules() error = %v", err)
+	}
+	want := []string{filepath.Join(base, "lib")}
+	if !slices.Equal(modules, want) {
+		t.Errorf("LocalModules() = %v, want %v", modules, want)
+	}
+	wantFiles := []string{filepath.Join(root, "go.mod"), filepath.Join(root, "go.work")}
+	if files := ModuleFiles(root); !slices.Equal(files, wantFiles) {
+		t.Errorf("ModuleFiles() = %v, want %v", files, wantFiles)
+	}
+
+	t.Run("workspace in parent", func(t *testing.T) {
+		work := filepath.Join(base, "go.work")
+		writeFile(t, work, "go 1.22\n\nuse (\n\t./app\n\t./shared\n)\n\nreplace example.com/tool => ./tool\n")
+
+		modules, err := LocalModules(root)
+		if err != nil {
+			t.Fatalf("LocalModules() error = %v", err)
+		}
+		want := []string{filepath.Join(base, "lib"), filepath.Join(base, "shared"), filepath.Join(base, "tool")}
+		if !slices.Equal(modules, want) {
+			t.Errorf("LocalModules() = %v, want %v", modules, want)
+		}
+		wantFiles := []string{filepath.Join(root, "go.mod"), work}
+		if files := ModuleFiles(root); !slices.Equal(files, wantFiles) {
+			t.Errorf("ModuleFiles() = %v, want %v", files, wantFiles)
+		}
+	})
+
+	t.Run("GOWORK=off", func(t *testing.T) {
+		t.Setenv("GOWORK", "off")
+
+		modules, err := LocalModules(root)
+		if err != nil {
+			t.Fatalf("LocalModules() error = %v", err)
+		}
+		if want := []string{filepath.Join(base, "lib")}; !slices.Equal(modules, want) {
+			t.Errorf("LocalModules() = %v, want %v", modules, want)
+		}
+	})
+}
+
+func TestListPackages(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	base := t.TempDir()
+	root := filepath.Join(base, "app")
+	writeFile(t, filepath.Join(root, "go.mod"), "module example.com/app\n\ngo 1.22\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n")
+	writeFile(t, filepath.Join(root, "cmd", "api", "main.go"), "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/internal/handler\"\n)\n\nfunc main() { fmt.Println(handler.Name) }\n")
+	writeFile(t, filepath.Join(root, "cmd", "worker", "main.go"), "package main\n\nimport \"example.com/app/internal/queue\"\n\nfunc main() { queue.Run() }\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "handler.go"), "package handler\n\nimport \"example.com/lib\"\n\nvar Name = lib.Name\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "debug.go"), "//go:build debug\n\npackage handler\n\nimport _ \"example.com/app/internal/debug\"\n")
+	writeFile(t, filepath.Join(root, "internal", "debug", "debug.go"), "package debug\n")
+	writeFile(t, filepath.Join(root, "internal", "queue", "queue.go"), "package queue\n\nfunc Run() {}\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "embed.go"), "package handler\n\nimport \"embed\"\n\n//go:embed templates static/*.css\nvar assets embed.FS\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "templates", "index.html"), "<html></html>\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "templates", "partials", "nav.html"), "<nav></nav>\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "static", "app.css"), "body {}\n")
+	writeFile(t, filepath.Join(root, "internal", "handler", "static", "app.js"), "\n")
+	writeFile(t, filepath.Join(root, "internal", "queue", "embed.go"), "package queue\n\nimport _ \"embed\"\n\n//go:embed jobs.json\nvar jobs string\n")
+	writeFile(t, filepath.Join(root, "internal", "queue", "jobs.json"), "[]\n")
+	writeFile(t, filepath.Join(base, "lib", "go.mod"), "module example.com/lib\n\ngo 1.22\n")
+	writeFile(t, filepath.Join(base, "lib", "lib.go"), "package lib\n\nconst Name = \"lib\"\n")
+
+	pkgs, err := ListPackages(context.Background(), root, []string{"./cmd/api"}, nil)
+	if err != nil {
+		t.Fatalf("ListPackages() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(root, "cmd", "api"),
+		filepath.Join(root, "internal", "handler"),
+		filepath.Join(base, "lib"),
+	}
+	slices.Sort(want)
+	if !slices.Equal(pkgs.Dirs, want) {
+		t.Errorf("ListPackages() Dirs = %v, want %v", pkgs.Dirs, want)
+	}
+
+	// Only the embed patterns of the packages built.
+	handler := filepath.Join(root, "internal", "handler")
+	wantEmbeds := []EmbedPattern{
+		{Dir: handler, Pattern: "static/*.css"},
+		{Dir: handler, Pattern: "templates"},
+	}
+	if !slices.Equal(pkgs.EmbedPatterns, wantEmbeds) {
+		t.Errorf("ListPackages() EmbedPatterns = %v, want %v", pkgs.EmbedPatterns, wantEmbeds)
+	}
+
+	pkgs, err = ListPackages(context.Background(), root, []string{"./cmd/api"}, []string{"debug"})
+	if err != nil {
+		t.Fatalf("ListPackages() error = %v", err)
+	}
+	if !slices.Contains(pkgs.Dirs, filepath.Join(root, "internal", "debug")) {
+		t.Errorf("ListPackages() with tag debug = %v, want it to include internal/debug", pkgs.Dirs)
+	}
+}
+
+func TestGoEnv(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	t.Setenv("GOOS", "windows")
+	t.Setenv("GOARCH", "arm64")
+
+	env, err := GoEnv(context.Background(), t.TempDir(), "GOOS", "GOARCH")
+	if err != nil {
+		t.Fatalf("GoEnv() error = %v", err)
+	}
+	if env["GOOS"] != "windows" || env["GOARCH"] != "arm64" {
+		t.Errorf("GoEnv() = %v, want GOOS=windows GOARCH=arm64", env)
+	}
+}
+
+func TestFindGit(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, ".git")
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), "1111111111111111111111111111111111111111\n")
+	writeFile(t, filepath.Join(gitDir, "packed-refs"), "# pack-refs with: peeled fully-peeled sorted\n2222222222222222222222222222222222222222 refs/heads/feature\n")
+
+	repo, ok := FindGit(filepath.Join(root, "cmd", "api"))
+	if !ok || repo.Dir != gitDir || repo.CommonDir != gitDir {
+		t.Fatalf("FindGit() = %+v, %v, want %s", repo, ok, gitDir)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	if head.String() != "main at 1111111" {
+		t.Errorf("Head() = %v, want main at 1111111", head)
+	}
+
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/feature\n")
+	if head, _ := repo.Head(); head.String() != "feature at 2222222" {
+		t.Errorf("Head() from packed-refs = %v, want feature at 2222222", head)
+	}
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "3333333333333333333333333333333333333333\n")
+	if head, _ := repo.Head(); head.String() != "detached at 3333333" {
+		t.Errorf("Head() detached = %v, want detached at 3333333", head)
+	}
+
+	if op, busy := repo.Busy(); busy {
+		t.Errorf("Busy() = %q, true, want false", op)
+	}
+	writeFile(t, filepath.Join(gitDir, "index.lock"), "")
+	if op, busy := repo.Busy(); !busy || op != "checkout" {
+		t.Errorf("Busy() = %q, %v, want checkout", op, busy)
+	}
+	if err := os.MkdirAll(filepath.Join(gitDir, "rebase-merge"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if op, busy := repo.Busy(); !busy || op != "rebase" {
+		t.Errorf("Busy() = %q, %v, want rebase", op, busy)
+	}
+
+	// A linked worktree keeps its HEAD in its own git directory and shares
+	// the refs of the main one.
+	wtGitDir := filepath.Join(gitDir, "worktrees", "wt")
+	wt := filepath.Join(t.TempDir(), "wt")
+	writeFile(t, filepath.Join(wt, ".git"), "gitdir: "+wtGitDir+"\n")
+	writeFile(t, filepath.Join(wtGitDir, "commondir"), "../..\n")
+	writeFile(t, filepath.Join(wtGitDir, "HEAD"), "ref: refs/heads/main\n")
+
+	repo, ok = FindGit(wt)
+	if !ok || repo.Dir != wtGitDir || repo.CommonDir != gitDir {
+		t.Fatalf("FindGit() for a worktree = %+v, %v", repo, ok)
+	}
+	if head, _ := repo.Head(); head.String() != "main at 1111111" {
+		t.Errorf("Head() in a worktree = %v, want main at 1111111", head)
+	}
+	if _, busy := repo.Busy(); busy {
+		t.Error("Busy() in a worktree = true for an operation in the main one")
+	}
+}
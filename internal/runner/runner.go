@@ -22,25 +22,43 @@ type Runner interface {
 	Restart(ctx context.Context) error
 	// Running returns true if the application is currently running.
 	Running() bool
+	// PID returns the process ID of the running application, or 0.
+	PID() int
+}
+
+// Exit describes how the application process ended.
+type Exit struct {
+	PID int
+	// Code is the exit code, or -1 when the process was ended by a signal.
+	Code int
+	// Stopped is true when Stop ended the process, rather than the process
+	// exiting on its own.
+	Stopped bool
 }
 
 // Config holds runner configuration.
 type Config struct {
-	Bin       string
-	Args      []string
-	Root      string
+	Bin  string
+	Args []string
+	Root string
+	// KillDelay is how long Stop waits after interrupting the process before
+	// killing it. Zero kills it right away.
 	KillDelay time.Duration
 	Stdout    io.Writer
 	Stderr    io.Writer
+	// OnExit, if set, is called when the process has ended, before a Stop
+	// waiting for it returns.
+	OnExit func(Exit)
 }
 
 type runner struct {
 	cfg Config
 
-	mu      sync.Mutex
-	cmd     *exec.Cmd
-	running bool
-	done    chan struct{}
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	running  bool
+	stopping bool
+	done     chan struct{}
 }
 
 // New creates a new Runner with the given configuration.
@@ -83,6 +101,7 @@ func (r *runner) Start(ctx context.Context) error {
 	}
 
 	r.running = true
+	r.stopping = false
 	r.done = make(chan struct{})
 
 	go r.wait()
@@ -91,16 +110,27 @@ func (r *runner) Start(ctx context.Context) error {
 }
 
 func (r *runner) wait() {
+	exit := Exit{Code: -1}
 	if r.cmd != nil && r.cmd.Process != nil {
 		_ = r.cmd.Wait()
+		exit.PID = r.cmd.Process.Pid
+		exit.Code = r.cmd.ProcessState.ExitCode()
 	}
 
 	r.mu.Lock()
 	r.running = false
-	if r.done != nil {
-		close(r.done)
-	}
+	exit.Stopped = r.stopping
+	done := r.done
 	r.mu.Unlock()
+
+	// Report the exit before Stop returns, so that it comes before whatever
+	// the caller does next.
+	if r.cfg.OnExit != nil {
+		r.cfg.OnExit(exit)
+	}
+	if done != nil {
+		close(done)
+	}
 }
 
 func (r *runner) Stop(ctx context.Context) error {
@@ -112,21 +142,17 @@ func (r *runner) Stop(ctx context.Context) error {
 
 	done := r.done
 	proc := r.cmd.Process
+	r.stopping = true
 	r.mu.Unlock()
 
 	// First try graceful shutdown.
 	_ = interruptProcess(proc)
 
 	// Wait for graceful shutdown or timeout.
-	killDelay := r.cfg.KillDelay
-	if killDelay <= 0 {
-		killDelay = 500 * time.Millisecond
-	}
-
 	select {
 	case <-done:
 		return nil
-	case <-time.After(killDelay):
+	case <-time.After(r.cfg.KillDelay):
 		// Force kill.
 		_ = killProcess(proc)
 	case <-ctx.Done():
@@ -161,3 +187,12 @@ func (r *runner) Running() bool {
 	defer r.mu.Unlock()
 	return r.running
 }
+
+func (r *runner) PID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.running || r.cmd == nil || r.cmd.Process == nil {
+		return 0
+	}
+	return r.cmd.Process.Pid
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -203,3 +204,92 @@ func TestRunner_Running(t *testing.T) {
 		t.Error("Running() = true before Start()")
 	}
 }
+
+func TestRunner_OnExit(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	crash := filepath.Join(tmpDir, "crash.sh")
+	if err := os.WriteFile(crash, []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	loop := filepath.Join(tmpDir, "loop.sh")
+	if err := os.WriteFile(loop, []byte("#!/bin/sh\nwhile true; do sleep 1; done\n"), 0755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	exits := make(chan Exit, 1)
+	newRunner := func(bin string) Runner {
+		return New(Config{
+			Bin:       bin,
+			Root:      tmpDir,
+			KillDelay: 100 * time.Millisecond,
+			Stdout:    &bytes.Buffer{},
+			Stderr:    &bytes.Buffer{},
+			OnExit:    func(e Exit) { exits <- e },
+		})
+	}
+
+	t.Run("exits on its own", func(t *testing.T) {
+		r := newRunner(crash)
+		if err := r.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		select {
+		case e := <-exits:
+			if e.Code != 3 || e.Stopped || e.PID == 0 {
+				t.Errorf("OnExit(%+v), want code 3, not stopped, with a PID", e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("OnExit was not called")
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		r := newRunner(loop)
+		if err := r.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		pid := r.PID()
+		if pid == 0 {
+			t.Error("PID() = 0 while running")
+		}
+		if err := r.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop() error = %v", err)
+		}
+		select {
+		case e := <-exits:
+			if !e.Stopped || e.PID != pid {
+				t.Errorf("OnExit(%+v), want stopped with PID %d", e, pid)
+			}
+		default:
+			t.Fatal("OnExit was not called before Stop() returned")
+		}
+		if r.PID() != 0 {
+			t.Errorf("PID() = %d after Stop(), want 0", r.PID())
+		}
+	})
+
+	t.Run("reported before Stop returns", func(t *testing.T) {
+		var reported atomic.Bool
+		r := New(Config{
+			Bin:       loop,
+			Root:      tmpDir,
+			KillDelay: 100 * time.Millisecond,
+			Stdout:    &bytes.Buffer{},
+			Stderr:    &bytes.Buffer{},
+			OnExit: func(Exit) {
+				time.Sleep(100 * time.Millisecond)
+				reported.Store(true)
+			},
+		})
+		if err := r.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if err := r.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop() error = %v", err)
+		}
+		if !reported.Load() {
+			t.Error("Stop() returned before OnExit")
+		}
+	})
+}
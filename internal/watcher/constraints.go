@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BuildConstraints describes the build environment that //go:build lines and
+// _GOOS and _GOARCH file name suffixes are evaluated against.
+type BuildConstraints struct {
+	// GOOS and GOARCH default to those of the go/build default context.
+	GOOS   string
+	GOARCH string
+	// Tags are the build tags given with -tags.
+	Tags []string
+	// CgoEnabled satisfies the "cgo" constraint.
+	CgoEnabled bool
+}
+
+func (c BuildConstraints) String() string {
+	s := fmt.Sprintf("GOOS=%s GOARCH=%s", c.GOOS, c.GOARCH)
+	if len(c.Tags) > 0 {
+		s += " tags=" + strings.Join(c.Tags, ",")
+	}
+	return s
+}
+
+// constraintFilter drops events for Go files that are not part of the build,
+// such as process_windows.go on Linux, and that were not part of it before
+// the change either.
+type constraintFilter struct {
+	ctx  build.Context
+	desc string
+
+	mu sync.Mutex
+	// included holds, per seen Go file, whether it was part of the build.
+	included map[string]bool
+}
+
+// newConstraintFilter returns nil when c is nil.
+func newConstraintFilter(c *BuildConstraints) *constraintFilter {
+	if c == nil {
+		return nil
+	}
+
+	env := *c
+	if env.GOOS == "" {
+		env.GOOS = build.Default.GOOS
+	}
+	if env.GOARCH == "" {
+		env.GOARCH = build.Default.GOARCH
+	}
+
+	ctx := build.Default
+	ctx.GOOS = env.GOOS
+	ctx.GOARCH = env.GOARCH
+	ctx.CgoEnabled = env.CgoEnabled
+	ctx.BuildTags = env.Tags
+
+	return &constraintFilter{
+		ctx:      ctx,
+		desc:     env.String(),
+		included: make(map[string]bool),
+	}
+}
+
+// match reports whether path is part of the build. Files other than Go
+// source files always are. With content, the file's //go:build line is
+// evaluated as well as its name. When path is excluded, reason says why.
+func (f *constraintFilter) match(path string, content bool) (ok bool, reason string) {
+	if filepath.Ext(path) != ".go" {
+		return true, ""
+	}
+	dir, name := filepath.Split(path)
+
+	nameOnly := f.ctx
+	nameOnly.OpenFile = func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("package p\n")), nil
+	}
+	if ok, err := nameOnly.MatchFile(dir, name); err == nil && !ok {
+		return false, "file name excluded by build constraints (" + f.desc + ")"
+	}
+	if !content {
+		return true, ""
+	}
+
+	ok, err := f.ctx.MatchFile(dir, name)
+	if err != nil {
+		// Gone or unreadable: let the build decide.
+		return true, ""
+	}
+	if !ok {
+		return false, "//go:build line excluded by build constraints (" + f.desc + ")"
+	}
+	return true, ""
+}
+
+// seed records whether path is part of the build, so that a change that
+// drops it from the build is still delivered.
+func (f *constraintFilter) seed(path string) {
+	if filepath.Ext(path) != ".go" {
+		return
+	}
+	ok, _ := f.match(path, true)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.included[path] = ok
+}
+
+// keep reports whether evt may change the build. When it does not, reason
+// says why.
+func (f *constraintFilter) keep(evt Event) (ok bool, reason string) {
+	if evt.Op == OpRescan || filepath.Ext(evt.Path) != ".go" {
+		return true, ""
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	was, known := f.included[evt.Path]
+	if evt.Op == OpRemove || evt.Op == OpRename {
+		delete(f.included, evt.Path)
+		if was {
+			return true, ""
+		}
+		if known {
+			return false, "was excluded by build constraints (" + f.desc + ")"
+		}
+		return f.match(evt.Path, false)
+	}
+
+	ok, reason = f.match(evt.Path, true)
+	f.included[evt.Path] = ok
+	if !ok && was {
+		// The change removed the file from the build.
+		return true, ""
+	}
+	return ok, reason
+}
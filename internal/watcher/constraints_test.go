@@ -0,0 +1,179 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConstraintFilter_Match(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":             "package main\n",
+		"process_windows.go":  "package main\n",
+		"process_linux.go":    "package main\n",
+		"asm_arm64.go":        "package main\n",
+		"signal_unix.go":      "//go:build unix\n\npackage main\n",
+		"debug.go":            "//go:build debug\n\npackage main\n",
+		"nodebug.go":          "//go:build !debug\n\npackage main\n",
+		"cgo.go":              "//go:build cgo\n\npackage main\n",
+		"gen.go":              "//go:build ignore\n\npackage main\n",
+		"_scratch.go":         "package main\n",
+		"index.html":          "<html></html>\n",
+		"templates_plan9.txt": "\n",
+	}
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+
+	f := newConstraintFilter(&BuildConstraints{GOOS: "linux", GOARCH: "amd64", Tags: []string{"debug"}})
+
+	tests := []struct {
+		name   string
+		want   bool
+		reason string
+	}{
+		{"main.go", true, ""},
+		{"process_windows.go", false, "file name"},
+		{"process_linux.go", true, ""},
+		{"asm_arm64.go", false, "file name"},
+		{"signal_unix.go", true, ""},
+		{"debug.go", true, ""},
+		{"nodebug.go", false, "//go:build line"},
+		{"cgo.go", false, "//go:build line"},
+		{"gen.go", false, "//go:build line"},
+		{"_scratch.go", false, "file name"},
+		{"index.html", true, ""},
+		{"templates_plan9.txt", true, ""},
+		{"missing_linux.go", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := f.match(filepath.Join(dir, tt.name), true)
+			if got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+			if !strings.HasPrefix(reason, tt.reason) {
+				t.Errorf("match(%q) reason = %q, want prefix %q", tt.name, reason, tt.reason)
+			}
+			if !got && !strings.Contains(reason, "GOOS=linux GOARCH=amd64 tags=debug") {
+				t.Errorf("match(%q) reason = %q, want the build environment", tt.name, reason)
+			}
+		})
+	}
+}
+
+func TestConstraintFilter_Keep(t *testing.T) {
+	dir := t.TempDir()
+	windows := filepath.Join(dir, "process_windows.go")
+	tagged := filepath.Join(dir, "feature.go")
+	writeFile(t, windows, "package main\n")
+	writeFile(t, tagged, "package main\n")
+
+	f := newConstraintFilter(&BuildConstraints{GOOS: "linux", GOARCH: "amd64"})
+	f.seed(windows)
+	f.seed(tagged)
+
+	keep := func(path string, op Op) bool {
+		ok, _ := f.keep(Event{Path: path, Op: op})
+		return ok
+	}
+
+	if keep(windows, OpWrite) {
+		t.Error("keep() = true for a write to a file excluded before and after")
+	}
+	if !keep(tagged, OpWrite) {
+		t.Error("keep() = false for a write to a file in the build")
+	}
+
+	// Adding a constraint takes the file out of the build, which the build
+	// must see; further writes are skipped.
+	writeFile(t, tagged, "//go:build feature\n\npackage main\n")
+	if !keep(tagged, OpWrite) {
+		t.Error("keep() = false for a write that excludes the file from the build")
+	}
+	if keep(tagged, OpWrite) {
+		t.Error("keep() = true for a write to a file excluded before and after")
+	}
+
+	// Removing the constraint brings it back.
+	writeFile(t, tagged, "package main\n")
+	if !keep(tagged, OpWrite) {
+		t.Error("keep() = false for a write that includes the file in the build")
+	}
+
+	if err := os.Remove(windows); err != nil {
+		t.Fatal(err)
+	}
+	if keep(windows, OpRemove) {
+		t.Error("keep() = true for removing an excluded file")
+	}
+	if !keep(filepath.Join(dir, "main.go"), OpRemove) {
+		t.Error("keep() = false for removing an unknown file in the build")
+	}
+	if !keep(dir, OpRescan) {
+		t.Error("keep() = false for a rescan")
+	}
+}
+
+func TestWatcher_Constraints(t *testing.T) {
+	tmpDir := t.TempDir()
+	windows := filepath.Join(tmpDir, "process_windows.go")
+	linux := filepath.Join(tmpDir, "process_linux.go")
+	writeFile(t, windows, "package main\n")
+	writeFile(t, linux, "package main\n")
+
+	skipped := make(chan string, 10)
+	w, err := New(Config{
+		Dirs:        []string{"."},
+		Filter:      NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce:    50 * time.Millisecond,
+		Root:        tmpDir,
+		Constraints: &BuildConstraints{GOOS: "linux", GOARCH: "amd64"},
+		OnSkip: func(path, reason string) {
+			skipped <- path
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	writeFile(t, windows, "package main\n\n// changed\n")
+	writeFile(t, linux, "package main\n\n// changed\n")
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != linux {
+			t.Errorf("Event path = %v, want %v", evt.Path, linux)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Timeout waiting for event")
+	}
+
+	select {
+	case path := <-skipped:
+		if path != windows {
+			t.Errorf("OnSkip path = %v, want %v", path, windows)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("OnSkip was not called")
+	}
+
+	select {
+	case evt := <-w.Events():
+		t.Errorf("unexpected event for an excluded file: %+v", evt)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,263 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDebounce is used when no positive debounce delay is configured.
+const defaultDebounce = 100 * time.Millisecond
+
+// holdInterval is how often a held flush asks again whether it may deliver.
+const holdInterval = 100 * time.Millisecond
+
+// An adaptive debounce delay grows by the configured delay for every
+// adaptiveStep events in a batch, up to adaptiveMax times the delay.
+const (
+	adaptiveStep = 10
+	adaptiveMax  = 4
+)
+
+// DebounceMode selects when debounced events are delivered.
+type DebounceMode string
+
+const (
+	// DebounceTrailing delivers events once no new event has arrived for
+	// the debounce delay.
+	DebounceTrailing DebounceMode = "trailing"
+	// DebounceLeading delivers the first event at once and the events that
+	// follow it at most once per debounce delay.
+	DebounceLeading DebounceMode = "leading"
+)
+
+// debouncer collects events per path and delivers them once no new event has
+// arrived for the debounce delay, or, in leading mode, at once and then at
+// most once per delay.
+type debouncer struct {
+	delay time.Duration
+	out   chan<- Event
+	// leading delivers the first event of a burst without waiting.
+	leading bool
+	// maxWait, if positive, caps how long events are kept back.
+	maxWait time.Duration
+	// adaptive stretches the delay for batches with many events.
+	adaptive bool
+	// keep, if set, decides at flush time whether an event is delivered,
+	// given the operations seen for its path.
+	keep func(Event, Op) bool
+	// dropped, if set, counts events dropped because out was full.
+	dropped *atomic.Uint64
+	// hold, if set, is asked before pending events are delivered. While it
+	// reports true, they are held back and more are collected.
+	hold func() bool
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	held    bool
+	pending map[string]Event
+	// first is when the oldest pending event arrived and count is the
+	// number of events added since.
+	first time.Time
+	count int
+	// quiet is the end of the window opened by the last leading delivery.
+	quiet time.Time
+	// ops accumulates every operation seen per pending path.
+	ops map[string]Op
+	// known holds the files that existed when last seen, so that a file
+	// replaced by an atomic save is reported as written rather than created.
+	known map[string]bool
+}
+
+func newDebouncer(delay time.Duration, out chan<- Event) *debouncer {
+	if delay <= 0 {
+		delay = defaultDebounce
+	}
+	return &debouncer{
+		delay:   delay,
+		out:     out,
+		pending: make(map[string]Event),
+		ops:     make(map[string]Op),
+		known:   make(map[string]bool),
+	}
+}
+
+// newDebouncerFor returns a debouncer with cfg's debounce settings.
+func newDebouncerFor(cfg Config, out chan<- Event) *debouncer {
+	d := newDebouncer(cfg.Debounce, out)
+	d.leading = cfg.DebounceMode == DebounceLeading
+	d.maxWait = cfg.MaxWait
+	d.adaptive = cfg.AdaptiveDebounce
+	d.hold = cfg.Hold
+	return d
+}
+
+// seen records that path exists before any event for it arrives.
+func (d *debouncer) seen(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.known[path] = true
+}
+
+// add records evt, replacing any pending event for the same path, and
+// restarts the debounce timer.
+func (d *debouncer) add(evt Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if len(d.pending) == 0 {
+		d.first = now
+		d.count = 0
+	}
+	d.count++
+	d.pending[evt.Path] = evt
+	d.ops[evt.Path] |= evt.Op
+
+	wait := d.wait(now)
+	if d.timer == nil {
+		d.timer = time.AfterFunc(wait, d.tick)
+	} else if !d.held {
+		d.timer.Reset(wait)
+	}
+}
+
+// window returns the debounce delay for the pending batch.
+func (d *debouncer) window() time.Duration {
+	if !d.adaptive {
+		return d.delay
+	}
+	return d.delay * time.Duration(min(1+d.count/adaptiveStep, adaptiveMax))
+}
+
+// wait returns how long to wait from now before delivering the pending events.
+func (d *debouncer) wait(now time.Time) time.Duration {
+	if d.leading {
+		// Nothing to wait for after a quiet window; otherwise the events
+		// are delivered when the current window ends.
+		return max(d.quiet.Sub(now), 0)
+	}
+
+	wait := d.window()
+	if d.maxWait > 0 {
+		wait = min(wait, max(d.first.Add(d.maxWait).Sub(now), 0))
+	}
+	return wait
+}
+
+// tick runs when the debounce delay has passed. It delivers the pending
+// events unless hold asks to keep them back, in which case it checks again
+// after holdInterval.
+func (d *debouncer) tick() {
+	if d.hold != nil && d.hold() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.held = true
+		d.timer.Reset(holdInterval)
+		return
+	}
+	d.flush()
+}
+
+// removeBelow records a removal for every known file below dir, for
+// directories that are deleted or moved out of the tree as a whole.
+func (d *debouncer) removeBelow(dir string, t time.Time) {
+	prefix := dir + string(filepath.Separator)
+
+	var paths []string
+	d.mu.Lock()
+	for path := range d.known {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, path := range paths {
+		d.add(Event{Path: path, Op: OpRemove, Time: t})
+	}
+}
+
+// flush delivers all pending events.
+func (d *debouncer) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Events released after a hold can outnumber the channel buffer. The
+	// receiver handles them as one batch, so the overflow is not counted.
+	released := d.held
+	d.held = false
+
+	for path, evt := range d.pending {
+		ops := d.ops[path]
+		evt, ok := d.collapse(evt, ops)
+		if !ok {
+			continue
+		}
+		if d.keep != nil && !d.keep(evt, ops) {
+			continue
+		}
+		select {
+		case d.out <- evt:
+		default:
+			// Channel full. The receiver has not caught up with the
+			// queued events yet, and handles this change along with them.
+			if d.dropped != nil && !released {
+				d.dropped.Add(1)
+			}
+		}
+	}
+	if d.leading && len(d.pending) > 0 {
+		d.quiet = time.Now().Add(d.window())
+	}
+	d.pending = make(map[string]Event)
+	d.ops = make(map[string]Op)
+}
+
+// collapse turns the operations seen for one path during the debounce window
+// into a single event. Editors that save atomically rename or remove the
+// original and create a new file in its place; that is reported as OpWrite.
+// A file created and removed again within the window is dropped, and a file
+// written and then chmodded is reported as written.
+func (d *debouncer) collapse(evt Event, ops Op) (Event, bool) {
+	if ops&(OpCreate|OpRemove|OpRename) == 0 {
+		if ops&OpWrite != 0 {
+			evt.Op = OpWrite
+		}
+		d.known[evt.Path] = true
+		return evt, true
+	}
+
+	if _, err := os.Stat(evt.Path); err == nil {
+		if d.known[evt.Path] || ops&(OpRemove|OpRename) != 0 {
+			evt.Op = OpWrite
+		} else {
+			evt.Op = OpCreate
+		}
+		d.known[evt.Path] = true
+		return evt, true
+	}
+
+	wasKnown := d.known[evt.Path]
+	delete(d.known, evt.Path)
+	if !wasKnown && ops&OpCreate != 0 {
+		return evt, false
+	}
+	if evt.Op != OpRename {
+		evt.Op = OpRemove
+	}
+	return evt, true
+}
+
+// stop cancels a pending flush.
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
@@ -0,0 +1,30 @@
+package watcher
+
+import "path/filepath"
+
+// editorTempPatterns match the base names of backup, swap and temporary files
+// that editors write while saving.
+var editorTempPatterns = []string{
+	"4913",             // Vim's check whether the directory is writable
+	"*~",               // Vim and Emacs backups
+	".*.sw[a-px]",      // Vim swap files
+	"*___jb_tmp___",    // JetBrains safe write
+	"*___jb_old___",    // JetBrains safe write
+	".#*",              // Emacs lock files
+	"#*#",              // Emacs auto-save files
+	".goutputstream-*", // GNOME gedit
+	"*.kate-swp",       // Kate swap files
+	".~lock.*#",        // LibreOffice lock files
+	".DS_Store",        // macOS Finder metadata
+}
+
+// isEditorTemp reports whether path names an editor temporary file.
+func isEditorTemp(path string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range editorTempPatterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsEditorTemp(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/project/main.go", false},
+		{"/project/4913", true},
+		{"/project/main.go~", true},
+		{"/project/.main.go.swp", true},
+		{"/project/.main.go.swo", true},
+		{"/project/.main.go.swx", true},
+		{"/project/main.go___jb_tmp___", true},
+		{"/project/main.go___jb_old___", true},
+		{"/project/.#main.go", true},
+		{"/project/#main.go#", true},
+		{"/project/.goutputstream-ABC123", true},
+		{"/project/main.go.kate-swp", true},
+		{"/project/.gitignore", false},
+		{"/project/swap.go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isEditorTemp(tt.path); got != tt.want {
+				t.Errorf("isEditorTemp(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebouncer_Collapse(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.go")
+	created := filepath.Join(dir, "created.go")
+	removed := filepath.Join(dir, "removed.go")
+	transient := filepath.Join(dir, "transient.go")
+	for _, path := range []string{existing, created} {
+		if err := os.WriteFile(path, []byte("package main"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := newDebouncer(time.Hour, nil)
+	d.seen(existing)
+	d.seen(removed)
+
+	tests := []struct {
+		name   string
+		path   string
+		ops    []Op
+		want   Op
+		wantOK bool
+	}{
+		{"write", existing, []Op{OpWrite}, OpWrite, true},
+		{"replaced by rename", existing, []Op{OpRename, OpCreate, OpWrite}, OpWrite, true},
+		{"replaced by remove", existing, []Op{OpRemove, OpCreate}, OpWrite, true},
+		{"renamed over known file", existing, []Op{OpCreate}, OpWrite, true},
+		{"new file", created, []Op{OpCreate, OpWrite}, OpCreate, true},
+		{"removed", removed, []Op{OpWrite, OpRemove}, OpRemove, true},
+		{"created and removed", transient, []Op{OpCreate, OpWrite, OpRemove}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops Op
+			for _, op := range tt.ops {
+				ops |= op
+			}
+			evt, ok := d.collapse(Event{Path: tt.path, Op: tt.ops[len(tt.ops)-1]}, ops)
+			if ok != tt.wantOK {
+				t.Fatalf("collapse() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && evt.Op != tt.want {
+				t.Errorf("collapse() op = %v, want %v", evt.Op, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_AtomicSave(t *testing.T) {
+	tmpDir := t.TempDir()
+	goFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(Config{
+		Dirs:              []string{"."},
+		Debounce:          50 * time.Millisecond,
+		Root:              tmpDir,
+		IgnoreEditorFiles: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Save like Vim with backupcopy=no: probe, move the original to a
+	// backup, write the new file and remove the backup.
+	probe := filepath.Join(tmpDir, "4913")
+	backup := goFile + "~"
+	steps := []func() error{
+		func() error { return os.WriteFile(probe, nil, 0644) },
+		func() error { return os.Remove(probe) },
+		func() error { return os.Rename(goFile, backup) },
+		func() error { return os.WriteFile(goFile, []byte("package main\n"), 0644) },
+		func() error { return os.Remove(backup) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []Event
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case evt := <-w.Events():
+			events = append(events, evt)
+		case <-timeout:
+			break loop
+		}
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got %d events %v, want a single event", len(events), events)
+	}
+	if events[0].Path != goFile || events[0].Op != OpWrite {
+		t.Errorf("event = %v %v, want %v %v", events[0].Path, events[0].Op, goFile, OpWrite)
+	}
+}
@@ -0,0 +1,126 @@
+package watcher
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// EmbedPattern is a //go:embed pattern of a Go package. The files it matches
+// are watched whatever the Filter says.
+type EmbedPattern struct {
+	// Dir is the absolute package directory.
+	Dir string
+	// Pattern is the pattern as written in the directive, relative to Dir.
+	// Like "go build", a directory matched by the pattern selects the files
+	// below it except those starting with "." or "_", unless the pattern
+	// has an "all:" prefix.
+	Pattern string
+}
+
+// String returns the pattern as a path below its package directory.
+func (p EmbedPattern) String() string {
+	return filepath.Join(p.Dir, filepath.FromSlash(p.Pattern))
+}
+
+// split returns the elements of the pattern and whether it has an "all:"
+// prefix.
+func (p EmbedPattern) split() (elems []string, all bool) {
+	pattern, all := strings.CutPrefix(p.Pattern, "all:")
+	return strings.Split(path.Clean(pattern), "/"), all
+}
+
+// rel returns the elements of path relative to the package directory, or
+// false if path is outside it.
+func (p EmbedPattern) rel(name string) ([]string, bool) {
+	rel, err := filepath.Rel(p.Dir, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, false
+	}
+	if rel == "." {
+		return nil, true
+	}
+	return strings.Split(filepath.ToSlash(rel), "/"), true
+}
+
+// match reports whether the file at name is selected by the pattern.
+func (p EmbedPattern) match(name string) bool {
+	rel, ok := p.rel(name)
+	if !ok {
+		return false
+	}
+	elems, all := p.split()
+	if len(rel) < len(elems) || !matchElems(elems, rel) {
+		return false
+	}
+	// Below a matched directory, hidden files are left out.
+	if !all {
+		for _, elem := range rel[len(elems):] {
+			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mayContain reports whether the pattern can select files in or below dir.
+func (p EmbedPattern) mayContain(dir string) bool {
+	// Directories leading to the package are needed to reach it.
+	if dir == p.Dir || strings.HasPrefix(p.Dir, dir+string(filepath.Separator)) {
+		return true
+	}
+	rel, ok := p.rel(dir)
+	if !ok {
+		return false
+	}
+	elems, _ := p.split()
+	n := min(len(rel), len(elems))
+	return matchElems(elems[:n], rel[:n])
+}
+
+// matchElems reports whether every element of name matches the pattern
+// element at the same position.
+func matchElems(pattern, name []string) bool {
+	for i := range min(len(pattern), len(name)) {
+		if ok, _ := path.Match(pattern[i], name[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// embedPatterns is the set of patterns a watcher follows.
+type embedPatterns []EmbedPattern
+
+// match reports whether any pattern selects the file at name.
+func (ps embedPatterns) match(name string) bool {
+	for _, p := range ps {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether dir must be watched because a pattern can select
+// files in or below it.
+func (ps embedPatterns) covers(dir string) bool {
+	for _, p := range ps {
+		if p.mayContain(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// dirs returns the package directories of the patterns.
+func (ps embedPatterns) dirs() []string {
+	var dirs []string
+	for _, p := range ps {
+		if len(dirs) == 0 || dirs[len(dirs)-1] != p.Dir {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEmbedPattern_Match(t *testing.T) {
+	dir := filepath.FromSlash("/app/web")
+
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"templates", "templates/index.html", true},
+		{"templates", "templates/partials/nav.html", true},
+		{"templates", "templates/.draft.html", false},
+		{"templates", "templates/_old/nav.html", false},
+		{"all:templates", "templates/_old/nav.html", true},
+		{"static/*.css", "static/app.css", true},
+		{"static/*.css", "static/app.js", false},
+		{"static/*.css", "static/css/app.css", false},
+		{"*.html", "index.html", true},
+		{"*.html", "other/index.html", false},
+		{"templates", "../templates/index.html", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			p := EmbedPattern{Dir: dir, Pattern: tt.pattern}
+			if got := p.match(filepath.Join(dir, filepath.FromSlash(tt.path))); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedPattern_MayContain(t *testing.T) {
+	dir := filepath.FromSlash("/app/web")
+
+	tests := []struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		{"templates", ".", true},
+		{"templates", "templates", true},
+		{"templates", "templates/partials", true},
+		{"templates", "static", false},
+		{"static/*.css", "static", true},
+		{"static/*.css", "static/css", false},
+		{"static/*.css", "static/vendor.css", true},
+		{"static/*.css", "other", false},
+		{"templates", "..", true},
+		{"templates", "../api", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.dir, func(t *testing.T) {
+			p := EmbedPattern{Dir: dir, Pattern: tt.pattern}
+			if got := p.mayContain(filepath.Join(dir, filepath.FromSlash(tt.dir))); got != tt.want {
+				t.Errorf("mayContain(%q) = %v, want %v", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_Embeds(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkg := filepath.Join(tmpDir, "web")
+	writeFile(t, filepath.Join(pkg, "web.go"), "package web\n")
+	writeFile(t, filepath.Join(pkg, "templates", "index.html"), "<html></html>\n")
+	writeFile(t, filepath.Join(pkg, "notes.txt"), "\n")
+
+	for _, backend := range []Backend{BackendFSNotify, BackendPoll} {
+		t.Run(string(backend), func(t *testing.T) {
+			// The package is watched flat, as with the "deps" scope, and its
+			// templates are excluded: the pattern wins over both.
+			w, err := New(Config{
+				Dirs: []string{pkg},
+				Filter: NewFilter(FilterConfig{
+					Extensions:  []string{".go"},
+					ExcludeDirs: []string{"templates"},
+					Root:        tmpDir,
+				}),
+				Debounce:     50 * time.Millisecond,
+				Root:         tmpDir,
+				Backend:      backend,
+				PollInterval: 20 * time.Millisecond,
+				Flat:         true,
+				Embeds:       []EmbedPattern{{Dir: pkg, Pattern: "templates"}},
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer w.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := w.Start(ctx); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			// A file that did not exist when the patterns were listed.
+			added := filepath.Join(pkg, "templates", "partials", string(backend)+".html")
+			writeFile(t, added, "<nav></nav>\n")
+			writeFile(t, filepath.Join(pkg, "notes.txt"), "changed\n")
+
+			select {
+			case evt := <-w.Events():
+				if evt.Path != added {
+					t.Errorf("Event path = %v, want %v", evt.Path, added)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for event")
+			}
+
+			select {
+			case evt := <-w.Events():
+				t.Errorf("unexpected event for an unmatched file: %+v", evt)
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -9,6 +10,9 @@ import (
 type Filter interface {
 	// Match returns true if the path should be watched/processed.
 	Match(path string) bool
+	// SkipDir returns true if the directory and everything below it can be
+	// left unwatched.
+	SkipDir(path string) bool
 }
 
 // FilterConfig holds filter configuration.
@@ -17,6 +21,17 @@ type FilterConfig struct {
 	ExcludeDirs  []string
 	ExcludeFiles []string
 	Root         string
+	// Include and Exclude are "**" glob patterns matched against
+	// root-relative paths; a leading "!" negates a pattern and the last
+	// matching pattern wins. When Include is set, it replaces Extensions.
+	Include []string
+	Exclude []string
+	// Names are base name patterns, such as "Makefile" or "*.env", of files
+	// that match whatever their extension.
+	Names []string
+	// GitIgnore enables .gitignore files at every level below Root and
+	// .git/info/exclude. .goreloadignore files are always honoured.
+	GitIgnore bool
 }
 
 type filter struct {
@@ -24,6 +39,10 @@ type filter struct {
 	excludeDirs  map[string]bool
 	excludeFiles []string
 	root         string
+	include      globRules
+	exclude      globRules
+	names        []string
+	ignore       *ignoreMatcher
 }
 
 // NewFilter creates a new Filter with the given configuration.
@@ -33,6 +52,12 @@ func NewFilter(cfg FilterConfig) Filter {
 		excludeDirs:  make(map[string]bool),
 		excludeFiles: cfg.ExcludeFiles,
 		root:         cfg.Root,
+		include:      compileGlobs(cfg.Include),
+		exclude:      compileGlobs(cfg.Exclude),
+		names:        cfg.Names,
+	}
+	if cfg.Root != "" {
+		f.ignore = newIgnoreMatcher(cfg.Root, cfg.GitIgnore)
 	}
 
 	for _, ext := range cfg.Extensions {
@@ -50,13 +75,7 @@ func NewFilter(cfg FilterConfig) Filter {
 }
 
 func (f *filter) Match(path string) bool {
-	// Make path relative to root if possible.
-	relPath := path
-	if f.root != "" {
-		if rel, err := filepath.Rel(f.root, path); err == nil {
-			relPath = rel
-		}
-	}
+	relPath := f.relPath(path)
 
 	// Check excluded directories.
 	if f.isInExcludedDir(relPath) {
@@ -68,6 +87,31 @@ func (f *filter) Match(path string) bool {
 		return false
 	}
 
+	slashPath := filepath.ToSlash(relPath)
+	if f.exclude.match(slashPath) {
+		return false
+	}
+
+	if f.ignore != nil {
+		// An edited ignore file must be read again.
+		switch filepath.Base(slashPath) {
+		case GitIgnoreFile, GoreloadIgnoreFile:
+			f.ignore.invalidate(ignoreBase(slashPath))
+		}
+		if f.ignore.ignored(slashPath, false) {
+			return false
+		}
+	}
+
+	if f.matchesName(path) {
+		return true
+	}
+
+	// Include patterns take the place of the extension check.
+	if len(f.include) > 0 {
+		return f.include.match(slashPath)
+	}
+
 	// Check extension.
 	ext := filepath.Ext(path)
 	if len(f.extensions) > 0 && !f.extensions[ext] {
@@ -77,6 +121,41 @@ func (f *filter) Match(path string) bool {
 	return true
 }
 
+func (f *filter) SkipDir(path string) bool {
+	relPath := f.relPath(path)
+	if relPath == "." {
+		return false
+	}
+	if f.excludeDirs[filepath.Base(relPath)] {
+		return true
+	}
+
+	slashPath := filepath.ToSlash(relPath)
+	if f.ignore != nil && f.ignore.ignored(slashPath, true) {
+		return true
+	}
+	return f.exclude.match(slashPath) && !f.exclude.mayMatchBelow(slashPath)
+}
+
+// ignoreBase returns the root-relative directory of a slash path, "" for the root.
+func ignoreBase(slashPath string) string {
+	dir := path.Dir(slashPath)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// relPath makes path relative to root if possible.
+func (f *filter) relPath(path string) string {
+	if f.root != "" {
+		if rel, err := filepath.Rel(f.root, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
+
 func (f *filter) isInExcludedDir(relPath string) bool {
 	parts := strings.Split(filepath.ToSlash(relPath), "/")
 	for _, part := range parts {
@@ -87,6 +166,16 @@ func (f *filter) isInExcludedDir(relPath string) bool {
 	return false
 }
 
+func (f *filter) matchesName(path string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range f.names {
+		if matched, err := filepath.Match(pattern, base); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *filter) matchesExcludedFile(relPath string) bool {
 	base := filepath.Base(relPath)
 	for _, pattern := range f.excludeFiles {
@@ -102,4 +191,3 @@ func (f *filter) matchesExcludedFile(relPath string) bool {
 	}
 	return false
 }
-
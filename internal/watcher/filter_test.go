@@ -216,3 +216,106 @@ func TestFilter_Match_GlobPatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_Match_IncludeExclude(t *testing.T) {
+	f := NewFilter(FilterConfig{
+		Extensions: []string{".go"},
+		Root:       "/project",
+		Include:    []string{"**/*.go", "web/templates/**/*.html", "!**/*_test.go"},
+		Exclude:    []string{"internal/**/mocks/*.go", "web/dist", "**/*.gen.go", "!api/gen/keep.gen.go"},
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"go file", "/project/internal/service/service.go", true},
+		{"included template", "/project/web/templates/pages/index.html", true},
+		{"html outside include", "/project/web/static/index.html", false},
+		{"negated include", "/project/internal/service/service_test.go", false},
+		{"mocks excluded", "/project/internal/service/mocks/service.go", false},
+		{"mocks outside internal", "/project/pkg/mocks/service.go", true},
+		{"web dist excluded", "/project/web/dist/app.go", false},
+		{"api dist kept", "/project/api/dist/app.go", true},
+		{"generated excluded", "/project/api/types.gen.go", false},
+		{"negated exclude", "/project/api/gen/keep.gen.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Match_Names(t *testing.T) {
+	f := NewFilter(FilterConfig{
+		Extensions:   []string{".go"},
+		ExcludeDirs:  []string{"vendor"},
+		ExcludeFiles: []string{"Makefile.local"},
+		Root:         "/project",
+		Names:        []string{"Makefile*", "Dockerfile", ".env", "go.mod"},
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"go file", "/project/main.go", true},
+		{"makefile", "/project/Makefile", true},
+		{"makefile variant", "/project/Makefile.dev", true},
+		{"dockerfile in subdirectory", "/project/deploy/api/Dockerfile", true},
+		{"dotenv", "/project/.env", true},
+		{"dotenv variant", "/project/.env.local", false},
+		{"go.mod", "/project/go.mod", true},
+		{"go.sum", "/project/go.sum", false},
+		{"excluded file", "/project/Makefile.local", false},
+		{"excluded directory", "/project/vendor/lib/go.mod", false},
+		{"other file", "/project/README.md", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_SkipDir(t *testing.T) {
+	f := NewFilter(FilterConfig{
+		Extensions:  []string{".go"},
+		ExcludeDirs: []string{"vendor"},
+		Root:        "/project",
+		Exclude:     []string{"web/dist", "**/testdata/**", "gen/**", "!gen/keep/*.go"},
+	})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/project", false},
+		{"/project/vendor", true},
+		{"/project/web/dist", true},
+		{"/project/web/dist/assets", true},
+		{"/project/api/dist", false},
+		{"/project/pkg/testdata", true},
+		// A negated pattern may re-include files below gen.
+		{"/project/gen", false},
+		{"/project/gen/keep", false},
+		{"/project/internal", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := f.SkipDir(tt.path); got != tt.want {
+				t.Errorf("SkipDir(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
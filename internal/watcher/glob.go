@@ -0,0 +1,71 @@
+package watcher
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// globRule is a "**"-aware glob pattern matched against root-relative,
+// slash-separated paths. A leading "!" negates the rule.
+type globRule struct {
+	pattern string
+	negate  bool
+}
+
+// globRules is an ordered list of rules in which the last matching rule wins.
+type globRules []globRule
+
+func compileGlobs(patterns []string) globRules {
+	rules := make(globRules, 0, len(patterns))
+	for _, p := range patterns {
+		r := globRule{pattern: p}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			r.pattern = p[1:]
+		}
+		r.pattern = strings.TrimSuffix(strings.TrimPrefix(r.pattern, "/"), "/")
+		if r.pattern != "" && doublestar.ValidatePattern(r.pattern) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// match reports whether relPath is selected by the rules. A rule matching a
+// directory also matches everything below it.
+func (rs globRules) match(relPath string) bool {
+	matched := false
+	for _, r := range rs {
+		if r.matches(relPath) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+func (r globRule) matches(relPath string) bool {
+	for p := relPath; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ok, _ := doublestar.Match(r.pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchBelow reports whether a negated rule could select a path below dir,
+// in which case dir must not be pruned.
+func (rs globRules) mayMatchBelow(dir string) bool {
+	for _, r := range rs {
+		if !r.negate {
+			continue
+		}
+		base, _ := doublestar.SplitPattern(r.pattern)
+		if base == "." || strings.HasPrefix(base, dir+"/") || base == dir ||
+			strings.HasPrefix(dir, base+"/") {
+			return true
+		}
+	}
+	return false
+}
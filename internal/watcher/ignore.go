@@ -0,0 +1,188 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Ignore files honoured by the filter.
+const (
+	GitIgnoreFile      = ".gitignore"
+	GoreloadIgnoreFile = ".goreloadignore"
+)
+
+// ignorePattern is a single line of an ignore file.
+type ignorePattern struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreRules are the patterns read from the ignore files of one directory.
+type ignoreRules struct {
+	// base is the directory relative to the root, "" for the root itself.
+	base     string
+	patterns []ignorePattern
+}
+
+// ignoreMatcher applies gitignore-style files found at every directory level
+// below root. Rules are loaded lazily and cached per directory.
+type ignoreMatcher struct {
+	root      string
+	gitignore bool
+
+	mu    sync.Mutex
+	rules map[string]*ignoreRules
+}
+
+func newIgnoreMatcher(root string, gitignore bool) *ignoreMatcher {
+	return &ignoreMatcher{
+		root:      root,
+		gitignore: gitignore,
+		rules:     make(map[string]*ignoreRules),
+	}
+}
+
+// ignored reports whether relPath, a slash-separated path relative to the
+// root, is ignored. As in git, nothing below an ignored directory can be
+// re-included.
+func (m *ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	if relPath == "." || relPath == "" || strings.HasPrefix(relPath, "../") || path.IsAbs(relPath) {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := strings.Split(relPath, "/")
+	for i := 1; i <= len(parts); i++ {
+		dir := i < len(parts) || isDir
+		if m.match(parts[:i], dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match evaluates the rules of every directory above the path given by parts.
+// The last matching pattern wins, and deeper files take precedence.
+func (m *ignoreMatcher) match(parts []string, isDir bool) bool {
+	relPath := strings.Join(parts, "/")
+	ignored := false
+
+	for i := 0; i < len(parts); i++ {
+		rules := m.load(strings.Join(parts[:i], "/"))
+		sub := relPath
+		if rules.base != "" {
+			sub = strings.TrimPrefix(relPath, rules.base+"/")
+		}
+
+		for _, p := range rules.patterns {
+			if p.dirOnly && !isDir {
+				continue
+			}
+			target := sub
+			if !p.anchored {
+				target = path.Base(sub)
+			}
+			if ok, _ := doublestar.Match(p.pattern, target); ok {
+				ignored = !p.negate
+			}
+		}
+	}
+
+	return ignored
+}
+
+// load returns the cached rules of the directory base, reading its ignore
+// files on first use. The root also honours .git/info/exclude.
+func (m *ignoreMatcher) load(base string) *ignoreRules {
+	if rules, ok := m.rules[base]; ok {
+		return rules
+	}
+
+	dir := filepath.Join(m.root, filepath.FromSlash(base))
+	rules := &ignoreRules{base: base}
+	if m.gitignore {
+		if base == "" {
+			rules.patterns = append(rules.patterns, readIgnoreFile(filepath.Join(dir, ".git", "info", "exclude"))...)
+		}
+		rules.patterns = append(rules.patterns, readIgnoreFile(filepath.Join(dir, GitIgnoreFile))...)
+	}
+	rules.patterns = append(rules.patterns, readIgnoreFile(filepath.Join(dir, GoreloadIgnoreFile))...)
+
+	m.rules[base] = rules
+	return rules
+}
+
+// invalidate drops the cached rules of the directory base so that an edited
+// ignore file is read again.
+func (m *ignoreMatcher) invalidate(base string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rules, base)
+}
+
+// readIgnoreFile parses a gitignore-style file. A missing file has no patterns.
+func readIgnoreFile(path string) []ignorePattern {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if p, ok := parseIgnoreLine(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func parseIgnoreLine(line string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+	switch {
+	case strings.HasPrefix(line, "!"):
+		p.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to the
+	// directory of the ignore file.
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" || !doublestar.ValidatePattern(line) {
+		return ignorePattern{}, false
+	}
+	p.pattern = line
+	return p, true
+}
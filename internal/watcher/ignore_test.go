@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ignorePattern
+		ok   bool
+	}{
+		{"", ignorePattern{}, false},
+		{"# comment", ignorePattern{}, false},
+		{"*.log", ignorePattern{pattern: "*.log"}, true},
+		{"*.log   ", ignorePattern{pattern: "*.log"}, true},
+		{"!keep.log", ignorePattern{pattern: "keep.log", negate: true}, true},
+		{`\!bang`, ignorePattern{pattern: "!bang"}, true},
+		{`\#hash`, ignorePattern{pattern: "#hash"}, true},
+		{"build/", ignorePattern{pattern: "build", dirOnly: true}, true},
+		{"/root.txt", ignorePattern{pattern: "root.txt", anchored: true}, true},
+		{"docs/*.md", ignorePattern{pattern: "docs/*.md", anchored: true}, true},
+		{"**/gen/", ignorePattern{pattern: "**/gen", dirOnly: true, anchored: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := parseIgnoreLine(tt.line)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseIgnoreLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFilter_Match_IgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "*_gen.go\n!keep_gen.go\n/local.go\nbuild/\n")
+	writeFile(t, filepath.Join(root, ".git", "info", "exclude"), "scratch.go\n")
+	writeFile(t, filepath.Join(root, ".goreloadignore"), "docs/\n")
+	writeFile(t, filepath.Join(root, "sub", ".gitignore"), "!other_gen.go\nlocal2.go\n")
+	// A file named like a dir-only pattern is not ignored.
+	writeFile(t, filepath.Join(root, "pkg", "build"), "")
+
+	tests := []struct {
+		path      string
+		gitignore bool
+		want      bool
+	}{
+		{"main.go", true, true},
+		{"api_gen.go", true, false},
+		{"keep_gen.go", true, true},
+		{"pkg/api_gen.go", true, false},
+		{"local.go", true, false},
+		{"pkg/local.go", true, true},
+		{"build/main.go", true, false},
+		{"pkg/build/main.go", true, false},
+		{"scratch.go", true, false},
+		{"docs/example.go", true, false},
+		{"sub/other_gen.go", true, true},
+		{"sub/local2.go", true, false},
+		{"local2.go", true, true},
+		// .gitignore is only applied when enabled; .goreloadignore always is.
+		{"api_gen.go", false, true},
+		{"scratch.go", false, true},
+		{"docs/example.go", false, false},
+	}
+
+	for _, tt := range tests {
+		f := NewFilter(FilterConfig{
+			Extensions: []string{".go"},
+			Root:       root,
+			GitIgnore:  tt.gitignore,
+		})
+		path := filepath.Join(root, filepath.FromSlash(tt.path))
+		if got := f.Match(path); got != tt.want {
+			t.Errorf("Match(%q) with gitignore=%v = %v, want %v", tt.path, tt.gitignore, got, tt.want)
+		}
+	}
+}
+
+func TestFilter_SkipDir_IgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "node_cache/\n/dist\n")
+	writeFile(t, filepath.Join(root, "web", ".gitignore"), "out/\n")
+
+	f := NewFilter(FilterConfig{
+		Extensions: []string{".go"},
+		Root:       root,
+		GitIgnore:  true,
+	})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"node_cache", true},
+		{"pkg/node_cache", true},
+		{"dist", true},
+		{"pkg/dist", false},
+		{"web/out", true},
+		{"out", false},
+		{"web", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := f.SkipDir(filepath.Join(root, tt.path)); got != tt.want {
+				t.Errorf("SkipDir(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Match_IgnoreFileChanged(t *testing.T) {
+	root := t.TempDir()
+	ignore := filepath.Join(root, ".goreloadignore")
+	writeFile(t, ignore, "a.go\n")
+
+	f := NewFilter(FilterConfig{Root: root})
+	if f.Match(filepath.Join(root, "a.go")) {
+		t.Fatal("a.go should be ignored")
+	}
+
+	writeFile(t, ignore, "b.go\n")
+	f.Match(ignore)
+
+	if !f.Match(filepath.Join(root, "a.go")) {
+		t.Error("a.go should no longer be ignored after the ignore file changed")
+	}
+	if f.Match(filepath.Join(root, "b.go")) {
+		t.Error("b.go should be ignored after the ignore file changed")
+	}
+}
@@ -0,0 +1,81 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// LimitError reports that the operating system refused to watch more
+// directories, such as when inotify's max_user_watches is exhausted.
+type LimitError struct {
+	// Watched is the number of directories that are being watched.
+	Watched int
+	// Total is the number of directories goreload tried to watch.
+	Total int
+	// Max is the system limit on watches, or 0 if it is unknown.
+	Max int
+	// InUse is the number of watches held by this process, or -1 if unknown.
+	InUse int
+	// Err is the error returned by the operating system.
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "watch limit reached: watched %d of %d directories: %v", e.Watched, e.Total, e.Err)
+	if e.Max > 0 {
+		fmt.Fprintf(&b, " (limit %d", e.Max)
+		if e.InUse >= 0 {
+			fmt.Fprintf(&b, ", %d in use by goreload", e.InUse)
+		}
+		b.WriteString(")")
+	}
+	if hint := limitHint(e.Err, e.Total); hint != "" {
+		b.WriteString("; ")
+		b.WriteString(hint)
+	}
+	return b.String()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// isLimitError reports whether err means that no more watches can be added.
+func isLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
+
+// overflow collects the directories and files that could not be watched
+// after a system limit was reached.
+type overflow struct {
+	err error
+	// roots are the topmost directories that are not watched.
+	roots []string
+	// dirs counts every directory that is not watched.
+	dirs int
+	// files are the individually watched files that are not watched.
+	files []string
+}
+
+// add records dir as not watched.
+func (o *overflow) add(dir string) {
+	if !o.contains(dir) {
+		o.roots = append(o.roots, dir)
+	}
+	o.dirs++
+}
+
+// contains reports whether path lies below an unwatched directory. Walks
+// visit a directory's contents right after it, so only the last root needs
+// to be checked.
+func (o *overflow) contains(path string) bool {
+	if len(o.roots) == 0 {
+		return false
+	}
+	root := o.roots[len(o.roots)-1]
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
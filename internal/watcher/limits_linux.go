@@ -0,0 +1,63 @@
+//go:build linux
+
+package watcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// watchLimit returns fs.inotify.max_user_watches.
+func watchLimit() (int, bool) {
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// watchesInUse counts the inotify watches held by this process.
+func watchesInUse() (int, bool) {
+	fds, err := filepath.Glob("/proc/self/fdinfo/*")
+	if err != nil || len(fds) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for _, fd := range fds {
+		f, err := os.Open(fd)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "inotify wd:") {
+				n++
+			}
+		}
+		f.Close()
+	}
+	return n, true
+}
+
+// limitHint returns the command that raises the limit behind err.
+func limitHint(err error, dirs int) string {
+	if errors.Is(err, syscall.EMFILE) {
+		return "raise the inotify instance limit with: sudo sysctl fs.inotify.max_user_instances=1024"
+	}
+	want := 524288
+	for want < dirs*2 {
+		want *= 2
+	}
+	return fmt.Sprintf("raise the limit with: sudo sysctl fs.inotify.max_user_watches=%d", want)
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package watcher
+
+import "fmt"
+
+// watchLimit is only known on Linux.
+func watchLimit() (int, bool) {
+	return 0, false
+}
+
+// watchesInUse is only known on Linux.
+func watchesInUse() (int, bool) {
+	return 0, false
+}
+
+// limitHint returns the command that raises the open file limit, which
+// bounds the number of watched directories on kqueue-based systems.
+func limitHint(err error, dirs int) string {
+	return fmt.Sprintf("raise the open file limit with: ulimit -n %d", dirs*2)
+}
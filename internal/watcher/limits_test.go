@@ -0,0 +1,169 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsLimitError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.ENOSPC, true},
+		{syscall.EMFILE, true},
+		{fmt.Errorf("add: %w", syscall.ENOSPC), true},
+		{syscall.ENOENT, false},
+		{errors.New("other"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isLimitError(tt.err); got != tt.want {
+			t.Errorf("isLimitError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	err := &LimitError{Watched: 8190, Total: 12000, Max: 8192, InUse: 8190, Err: syscall.ENOSPC}
+
+	msg := err.Error()
+	for _, want := range []string{"8190 of 12000 directories", "limit 8192", "8190 in use"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Error() = %q, want it to contain %q", msg, want)
+		}
+	}
+	if hint := limitHint(err.Err, err.Total); !strings.Contains(msg, hint) {
+		t.Errorf("Error() = %q, want it to contain hint %q", msg, hint)
+	}
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Error("errors.Is(err, ENOSPC) = false, want true")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	var ov overflow
+	sep := string(filepath.Separator)
+	a := sep + filepath.Join("project", "a")
+	b := sep + filepath.Join("project", "b")
+
+	ov.add(a)
+	ov.add(filepath.Join(a, "x"))
+	ov.add(b)
+
+	if len(ov.roots) != 2 || ov.roots[0] != a || ov.roots[1] != b {
+		t.Errorf("roots = %v, want [%s %s]", ov.roots, a, b)
+	}
+	if ov.dirs != 3 {
+		t.Errorf("dirs = %d, want 3", ov.dirs)
+	}
+	if !ov.contains(filepath.Join(b, "y")) {
+		t.Error("contains() = false for a directory below the last root")
+	}
+	if ov.contains(b + "c") {
+		t.Error("contains() = true for a sibling sharing a name prefix")
+	}
+}
+
+func TestWatcher_PollOverflow(t *testing.T) {
+	tmpDir := t.TempDir()
+	polled := filepath.Join(tmpDir, "polled")
+	if err := os.Mkdir(polled, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	nw, err := newNotifyWatcher(Config{
+		Root:         tmpDir,
+		Debounce:     20 * time.Millisecond,
+		PollInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("newNotifyWatcher() error = %v", err)
+	}
+	w := nw.(*watcher)
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ov := overflow{err: syscall.ENOSPC}
+	ov.add(polled)
+	if err := w.pollOverflow(ctx, &ov); err != nil {
+		t.Fatalf("pollOverflow() error = %v", err)
+	}
+	if got := w.Stats().PolledDirs; got != 1 {
+		t.Errorf("PolledDirs = %d, want 1", got)
+	}
+
+	goFile := filepath.Join(polled, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != goFile {
+			t.Errorf("Event path = %v, want %v", evt.Path, goFile)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for event from overflow poller")
+	}
+}
+
+func TestWatcher_PollOverflowFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "config", "app.env")
+
+	nw, err := newNotifyWatcher(Config{
+		Root:         tmpDir,
+		Debounce:     20 * time.Millisecond,
+		PollInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("newNotifyWatcher() error = %v", err)
+	}
+	w := nw.(*watcher)
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Past the limit, individual files are polled too.
+	ov := overflow{err: syscall.ENOSPC}
+	if err := w.addFile(file, &ov); err != nil {
+		t.Fatalf("addFile() error = %v", err)
+	}
+	if len(ov.files) != 1 || w.files[file] {
+		t.Fatalf("addFile() past the limit: overflow files = %v, watched = %v", ov.files, w.files[file])
+	}
+	if err := w.limitError(&ov); err.Total != 1 {
+		t.Errorf("limitError().Total = %d, want 1 for the file", err.Total)
+	}
+	if err := w.pollOverflow(ctx, &ov); err != nil {
+		t.Fatalf("pollOverflow() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != file {
+			t.Errorf("Event path = %v, want %v", evt.Path, file)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for event from overflow poller")
+	}
+}
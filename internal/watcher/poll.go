@@ -0,0 +1,253 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the scan interval of the polling backend when none is configured.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// fileState is the snapshot of a file used to detect changes between scans.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    uint64
+}
+
+// poller detects changes by periodically scanning the watched directories.
+// It works on file systems that do not deliver change notifications, such as
+// Docker bind mounts on macOS and Windows hosts or network file systems.
+type poller struct {
+	cfg     Config
+	events  chan Event
+	errors  chan error
+	done    chan struct{}
+	mu      sync.Mutex
+	started bool
+
+	// roots are the directories scanned.
+	roots []string
+	state map[string]fileState
+	// dirs is the number of directories seen by the last scan.
+	dirs    int
+	changes *changeFilter
+	deb     *debouncer
+	counters
+}
+
+func newPoller(cfg Config) *poller {
+	return newPollerWith(cfg, make(chan Event, 100), make(chan error, 10))
+}
+
+// newPollerWith creates a poller that reports to the given channels.
+func newPollerWith(cfg Config, events chan Event, errors chan error) *poller {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	p := &poller{
+		cfg:     cfg,
+		events:  events,
+		errors:  errors,
+		done:    make(chan struct{}),
+		roots:   cfg.roots(),
+		changes: newChangeFilter(cfg),
+	}
+	p.deb = newDebouncerFor(cfg, p.events)
+	p.deb.keep = p.changes.keep
+	p.deb.dropped = &p.droppedEvents
+	return p
+}
+
+func (p *poller) Start(ctx context.Context) error {
+	p.mu.Lock()
+	if p.started {
+		p.mu.Unlock()
+		return fmt.Errorf("watcher already started")
+	}
+	p.started = true
+	p.mu.Unlock()
+
+	state, err := p.scan()
+	if err != nil {
+		return err
+	}
+	p.state = state
+	for path := range state {
+		p.deb.seen(path)
+		p.changes.seed(path)
+	}
+
+	go p.loop(ctx)
+
+	return nil
+}
+
+func (p *poller) loop(ctx context.Context) {
+	deb := p.deb
+
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			deb.stop()
+			deb.flush()
+			return
+
+		case <-p.done:
+			deb.stop()
+			return
+
+		case <-ticker.C:
+			state, err := p.scan()
+			if err != nil {
+				select {
+				case p.errors <- err:
+				default:
+					p.droppedErrors.Add(1)
+				}
+				continue
+			}
+
+			now := time.Now()
+			for path, cur := range state {
+				prev, ok := p.state[path]
+				switch {
+				case !ok:
+					deb.add(Event{Path: path, Op: OpCreate, Time: now})
+				case cur != prev:
+					deb.add(Event{Path: path, Op: OpWrite, Time: now})
+				}
+			}
+			for path := range p.state {
+				if _, ok := state[path]; !ok {
+					deb.add(Event{Path: path, Op: OpRemove, Time: now})
+				}
+			}
+			p.state = state
+		}
+	}
+}
+
+// scan snapshots every file that passes the filter, plus the individually
+// watched files.
+func (p *poller) scan() (map[string]fileState, error) {
+	state := make(map[string]fileState)
+	dirs := 0
+
+	walker := newWalker(p.cfg.FollowSymlinks)
+	for _, dir := range p.roots {
+		err := walker.walk(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Files may disappear while scanning.
+				if os.IsNotExist(err) && path != dir {
+					return nil
+				}
+				return err
+			}
+
+			if d.IsDir() {
+				if p.cfg.skipDir(path, dir) {
+					return filepath.SkipDir
+				}
+				dirs++
+				return nil
+			}
+
+			if p.cfg.IgnoreEditorFiles && isEditorTemp(path) {
+				return nil
+			}
+			if !p.cfg.match(path) {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				state[path] = p.stat(path, fi)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", dir, err)
+		}
+	}
+
+	for _, file := range p.cfg.Files {
+		file = p.cfg.absPath(file)
+		if fi, err := os.Stat(file); err == nil {
+			state[file] = p.stat(file, fi)
+		}
+	}
+
+	p.mu.Lock()
+	p.dirs = dirs
+	p.mu.Unlock()
+
+	return state, nil
+}
+
+func (p *poller) stat(path string, fi fs.FileInfo) fileState {
+	st := fileState{modTime: fi.ModTime(), size: fi.Size()}
+	if p.cfg.PollHash {
+		st.hash, _ = hashFile(path)
+	}
+	return st
+}
+
+// hashFile returns a 64-bit FNV-1a hash of the file contents.
+func hashFile(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := fnv.New64a()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum64(), nil
+}
+
+func (p *poller) Backend() Backend {
+	return BackendPoll
+}
+
+func (p *poller) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.counters.stats()
+	stats.WatchedDirs = p.dirs
+	return stats
+}
+
+func (p *poller) Events() <-chan Event {
+	return p.events
+}
+
+func (p *poller) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *poller) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		// Already closed.
+	default:
+		close(p.done)
+		p.deb.stop()
+		p.deb.flush()
+	}
+
+	return nil
+}
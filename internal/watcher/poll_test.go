@@ -0,0 +1,155 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew_Backend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		backend Backend
+		want    Backend
+	}{
+		{"", BackendFSNotify},
+		{BackendFSNotify, BackendFSNotify},
+		{BackendPoll, BackendPoll},
+		// A local temp dir delivers events, so auto keeps fsnotify.
+		{BackendAuto, BackendFSNotify},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			w, err := New(Config{
+				Dirs:    []string{"."},
+				Root:    tmpDir,
+				Backend: tt.backend,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer w.Close()
+
+			if got := w.Backend(); got != tt.want {
+				t.Errorf("Backend() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoller_Events(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	existing := filepath.Join(tmpDir, "existing.go")
+	if err := os.WriteFile(existing, []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	vendorDir := filepath.Join(tmpDir, "vendor")
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		t.Fatalf("create vendor dir: %v", err)
+	}
+
+	w, err := New(Config{
+		Dirs: []string{"."},
+		Filter: NewFilter(FilterConfig{
+			Extensions: []string{".go"},
+			Root:       tmpDir,
+		}),
+		Debounce:     20 * time.Millisecond,
+		Root:         tmpDir,
+		ExcludeDirs:  []string{"vendor"},
+		Backend:      BackendPoll,
+		PollInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	expect := func(path string, op Op) {
+		t.Helper()
+		select {
+		case evt := <-w.Events():
+			if evt.Path != path || evt.Op != op {
+				t.Errorf("Event = %v %v, want %v %v", evt.Op, evt.Path, op, path)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Timeout waiting for %v %v", op, path)
+		}
+	}
+
+	// Excluded directories and filtered files are not reported.
+	if err := os.WriteFile(filepath.Join(vendorDir, "lib.go"), []byte("package lib"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "README.md"), []byte("# readme"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	created := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(created, []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	expect(created, OpCreate)
+
+	if err := os.WriteFile(existing, []byte("package main\n\nfunc main() {}"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	expect(existing, OpWrite)
+
+	if err := os.Remove(existing); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	expect(existing, OpRemove)
+
+	select {
+	case evt := <-w.Events():
+		t.Errorf("Unexpected event: %v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPoller_Hash(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(file, []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("stat file: %v", err)
+	}
+
+	p := newPoller(Config{Dirs: []string{"."}, Root: tmpDir, PollHash: true})
+	before, err := p.scan()
+	if err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+
+	// Same size and modification time, different content.
+	if err := os.WriteFile(file, []byte("package mail"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(file, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	after, err := p.scan()
+	if err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if before[file] == after[file] {
+		t.Error("scan() did not detect a content change with unchanged mtime and size")
+	}
+}
@@ -0,0 +1,60 @@
+package watcher
+
+import (
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// probeTimeout is how long probeNotify waits for the probe write to be reported.
+const probeTimeout = time.Second
+
+// probeNotify reports whether fsnotify delivers events for the first watched
+// directory. It writes a temporary file there and waits for the matching
+// event. When the probe cannot be performed, fsnotify is assumed to work.
+//
+// The probe is a local write, so it cannot tell whether writes made by
+// another host are reported, as with Docker Desktop bind mounts edited on
+// the host.
+func probeNotify(cfg Config) bool {
+	if len(cfg.Dirs) == 0 {
+		return true
+	}
+	dir := cfg.absPath(cfg.Dirs[0])
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return false
+	}
+	defer fw.Close()
+
+	if err := fw.Add(dir); err != nil {
+		return true
+	}
+
+	f, err := os.CreateTemp(dir, ".goreload-probe-*")
+	if err != nil {
+		return true
+	}
+	name := f.Name()
+	defer os.Remove(name)
+	_, _ = f.WriteString("probe")
+	_ = f.Close()
+
+	timeout := time.After(probeTimeout)
+	for {
+		select {
+		case evt, ok := <-fw.Events:
+			if !ok {
+				return false
+			}
+			if evt.Name == name {
+				return true
+			}
+		case <-fw.Errors:
+		case <-timeout:
+			return false
+		}
+	}
+}
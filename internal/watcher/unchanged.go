@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ParseOp returns the Op named by s, case-insensitively: create, write,
+// remove, rename or chmod.
+func ParseOp(s string) (Op, error) {
+	switch strings.ToLower(s) {
+	case "create":
+		return OpCreate, nil
+	case "write":
+		return OpWrite, nil
+	case "remove":
+		return OpRemove, nil
+	case "rename":
+		return OpRename, nil
+	case "chmod":
+		return OpChmod, nil
+	default:
+		return 0, fmt.Errorf("unknown operation %q", s)
+	}
+}
+
+// changeFilter drops events that do not change anything worth rebuilding
+// for: operations listed in Config.IgnoreOps, with Config.Constraints
+// changes to Go files outside the build and, with Config.IgnoreUnchanged,
+// events after which a file still has the content it had before.
+type changeFilter struct {
+	ignoreOps   Op
+	constraints *constraintFilter
+	onSkip      func(path, reason string)
+
+	mu sync.Mutex
+	// hashes holds the last seen content hash per file. It is nil when
+	// contents are not compared.
+	hashes map[string]uint64
+}
+
+func newChangeFilter(cfg Config) *changeFilter {
+	c := &changeFilter{
+		ignoreOps:   cfg.IgnoreOps,
+		constraints: newConstraintFilter(cfg.Constraints),
+		onSkip:      cfg.OnSkip,
+	}
+	if cfg.IgnoreUnchanged {
+		c.hashes = make(map[string]uint64)
+	}
+	return c
+}
+
+// seed records the current content of path so that the first event for it
+// can already be compared.
+func (c *changeFilter) seed(path string) {
+	if c.constraints != nil {
+		c.constraints.seed(path)
+	}
+	if c.hashes == nil {
+		return
+	}
+	h, err := hashFile(path)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[path] = h
+}
+
+// keep reports whether evt should be delivered. ops holds every operation
+// seen for the path since the last delivery; the event is only dropped for
+// Config.IgnoreOps when all of them are ignored.
+func (c *changeFilter) keep(evt Event, ops Op) bool {
+	if ops&^c.ignoreOps == 0 {
+		return false
+	}
+	if c.constraints != nil {
+		if ok, reason := c.constraints.keep(evt); !ok {
+			if c.onSkip != nil {
+				c.onSkip(evt.Path, reason)
+			}
+			return false
+		}
+	}
+	if c.hashes == nil || evt.Op == OpRescan {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if evt.Op == OpRemove || evt.Op == OpRename {
+		delete(c.hashes, evt.Path)
+		return true
+	}
+
+	h, err := hashFile(evt.Path)
+	if err != nil {
+		// Gone or unreadable: let the build decide.
+		delete(c.hashes, evt.Path)
+		return true
+	}
+	prev, ok := c.hashes[evt.Path]
+	c.hashes[evt.Path] = h
+	return !ok || prev != h
+}
@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOp(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Op
+		wantErr bool
+	}{
+		{"create", OpCreate, false},
+		{"WRITE", OpWrite, false},
+		{"remove", OpRemove, false},
+		{"rename", OpRename, false},
+		{"Chmod", OpChmod, false},
+		{"touch", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOp(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOp(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOp(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeFilter_Keep(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newChangeFilter(Config{IgnoreUnchanged: true, IgnoreOps: OpChmod})
+	c.seed(file)
+
+	steps := []struct {
+		name    string
+		content string
+		op      Op
+		want    bool
+	}{
+		{"same content", "package main", OpWrite, false},
+		{"new content", "package main\n", OpWrite, true},
+		{"rewrite with same content", "package main\n", OpCreate, false},
+		{"ignored op", "package main // changed", OpChmod, false},
+		{"change after ignored op", "package main // changed", OpWrite, true},
+		{"remove", "", OpRemove, true},
+		{"recreate", "package main // changed", OpCreate, true},
+	}
+
+	for _, step := range steps {
+		if step.op == OpRemove {
+			os.Remove(file)
+		} else if err := os.WriteFile(file, []byte(step.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.keep(Event{Path: file, Op: step.op}, step.op); got != step.want {
+			t.Errorf("%s: keep() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestChangeFilter_Disabled(t *testing.T) {
+	c := newChangeFilter(Config{})
+	if !c.keep(Event{Path: "/does/not/exist.go", Op: OpChmod}, OpChmod) {
+		t.Error("keep() = false, want true when nothing is ignored")
+	}
+}
+
+func TestWatcher_IgnoreUnchanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	goFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(Config{
+		Dirs:            []string{"."},
+		Filter:          NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce:        50 * time.Millisecond,
+		Root:            tmpDir,
+		IgnoreUnchanged: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Rewriting identical content is not reported.
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case evt := <-w.Events():
+		t.Fatalf("unexpected event for unchanged file: %+v", evt)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(goFile, []byte("package main\n\nfunc main() {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case evt := <-w.Events():
+		if evt.Path != goFile {
+			t.Errorf("Event path = %v, want %v", evt.Path, goFile)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Timeout waiting for event")
+	}
+}
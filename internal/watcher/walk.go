@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileID identifies a directory independently of the path it is reached by.
+type fileID struct {
+	dev, ino uint64
+	// path is the resolved path, where device and inode numbers are not
+	// available.
+	path string
+}
+
+// walker walks directory trees like filepath.WalkDir. With follow, symbolic
+// links to directories are walked as if they were directories, and reported
+// under the link's path. A directory reached by a second path, through
+// another link or a link cycle, is skipped.
+type walker struct {
+	follow bool
+	// seen maps the directories walked so far to the path they were first
+	// reached by.
+	seen map[fileID]string
+}
+
+func newWalker(follow bool) *walker {
+	return &walker{follow: follow, seen: make(map[fileID]string)}
+}
+
+func (w *walker) walk(root string, fn fs.WalkDirFunc) error {
+	if !w.follow {
+		return filepath.WalkDir(root, fn)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walkDir(root, info, fn)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (w *walker) walkDir(path string, info fs.FileInfo, fn fs.WalkDirFunc) error {
+	d := fs.FileInfoToDirEntry(info)
+	if !info.IsDir() {
+		return fn(path, d, nil)
+	}
+
+	if id, ok := fileIDOf(path, info); ok {
+		if first, ok := w.seen[id]; ok && first != path {
+			return nil
+		}
+		w.seen[id] = path
+	}
+
+	if err := fn(path, d, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := fn(path, d, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		info, err := entry.Info()
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			// A dangling link is reported as the link itself.
+			if target, err := os.Stat(child); err == nil {
+				info = target
+			}
+		}
+		if err != nil {
+			err = fn(child, entry, err)
+		} else {
+			err = w.walkDir(child, info, fn)
+		}
+		if err != nil {
+			if errors.Is(err, filepath.SkipDir) && !entry.IsDir() {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// forget drops the directories at or below dir, so that they can be walked
+// again by another path.
+func (w *walker) forget(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for id, path := range w.seen {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			delete(w.seen, id)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+func TestWalker(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "app")
+	shared := filepath.Join(base, "shared")
+	writeFile(t, filepath.Join(root, "main.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "pkg", "pkg.go"), "package pkg\n")
+	writeFile(t, filepath.Join(shared, "lib", "lib.go"), "package lib\n")
+
+	// A link out of the tree, a second link to the same directory, a link
+	// back up to the root and a dangling link.
+	symlink(t, shared, filepath.Join(root, "shared"))
+	symlink(t, shared, filepath.Join(root, "vendored"))
+	symlink(t, root, filepath.Join(root, "pkg", "loop"))
+	symlink(t, filepath.Join(base, "missing"), filepath.Join(root, "dangling"))
+
+	walk := func(follow bool) []string {
+		var paths []string
+		err := newWalker(follow).walk(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			if d.IsDir() {
+				rel += "/"
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walk() error = %v", err)
+		}
+		return paths
+	}
+
+	want := []string{"./", "dangling", "main.go", "pkg/", "pkg/loop", "pkg/pkg.go", "shared", "vendored"}
+	if got := walk(false); !slices.Equal(got, want) {
+		t.Errorf("walk() without follow = %v, want %v", got, want)
+	}
+
+	want = []string{"./", "dangling", "main.go", "pkg/", "pkg/pkg.go", "shared/", "shared/lib/", "shared/lib/lib.go"}
+	if got := walk(true); !slices.Equal(got, want) {
+		t.Errorf("walk() with follow = %v, want %v", got, want)
+	}
+}
+
+func TestWalker_Forget(t *testing.T) {
+	base := t.TempDir()
+	shared := filepath.Join(base, "shared")
+	writeFile(t, filepath.Join(shared, "lib.go"), "package lib\n")
+	symlink(t, shared, filepath.Join(base, "a"))
+	symlink(t, shared, filepath.Join(base, "b"))
+
+	w := newWalker(true)
+	count := func(root string) int {
+		n := 0
+		_ = w.walk(root, func(path string, d fs.DirEntry, err error) error {
+			n++
+			return err
+		})
+		return n
+	}
+
+	if n := count(filepath.Join(base, "a")); n != 2 {
+		t.Errorf("walk(a) visited %d entries, want 2", n)
+	}
+	// Walking the same path again, as a rescan does, is allowed.
+	if n := count(filepath.Join(base, "a")); n != 2 {
+		t.Errorf("walk(a) again visited %d entries, want 2", n)
+	}
+	if n := count(filepath.Join(base, "b")); n != 0 {
+		t.Errorf("walk(b) visited %d entries, want 0 for a directory seen under a", n)
+	}
+	w.forget(filepath.Join(base, "a"))
+	if n := count(filepath.Join(base, "b")); n != 2 {
+		t.Errorf("walk(b) after forget(a) visited %d entries, want 2", n)
+	}
+}
+
+func TestWatcher_FollowSymlinks(t *testing.T) {
+	for _, backend := range []Backend{BackendFSNotify, BackendPoll} {
+		t.Run(string(backend), func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "app")
+			shared := filepath.Join(base, "shared")
+			writeFile(t, filepath.Join(root, "main.go"), "package main\n")
+			writeFile(t, filepath.Join(shared, "lib", "lib.go"), "package lib\n")
+			symlink(t, shared, filepath.Join(root, "shared"))
+			symlink(t, root, filepath.Join(root, "loop"))
+
+			w, err := New(Config{
+				Dirs:           []string{"."},
+				Filter:         NewFilter(FilterConfig{Extensions: []string{".go"}, Root: root}),
+				Debounce:       50 * time.Millisecond,
+				Root:           root,
+				Backend:        backend,
+				PollInterval:   50 * time.Millisecond,
+				FollowSymlinks: true,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer w.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := w.Start(ctx); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+
+			// Changes in the target are reported under the link.
+			writeFile(t, filepath.Join(shared, "lib", "lib.go"), "package lib\n\n// changed\n")
+			want := filepath.Join(root, "shared", "lib", "lib.go")
+
+			select {
+			case evt := <-w.Events():
+				if evt.Path != want {
+					t.Errorf("Event path = %v, want %v", evt.Path, want)
+				}
+			case err := <-w.Errors():
+				t.Fatalf("Unexpected error: %v", err)
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for event")
+			}
+		})
+	}
+}
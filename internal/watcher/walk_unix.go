@@ -0,0 +1,17 @@
+//go:build !windows
+
+package watcher
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileIDOf returns the device and inode numbers of info.
+func fileIDOf(_ string, info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package watcher
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// fileIDOf returns the resolved path of path, as file information on
+// Windows carries no file index.
+func fileIDOf(path string, _ fs.FileInfo) (fileID, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	return fileID{path: resolved}, true
+}
@@ -3,10 +3,15 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -22,6 +27,10 @@ const (
 	OpRemove
 	OpRename
 	OpChmod
+	// OpRescan reports that events were lost, for example because the
+	// kernel's event queue overflowed, and the watched tree was scanned
+	// again. Its Path is the root; everything should be rebuilt.
+	OpRescan
 )
 
 func (o Op) String() string {
@@ -36,6 +45,8 @@ func (o Op) String() string {
 		return "RENAME"
 	case OpChmod:
 		return "CHMOD"
+	case OpRescan:
+		return "RESCAN"
 	default:
 		return "UNKNOWN"
 	}
@@ -56,17 +67,194 @@ type Watcher interface {
 	Events() <-chan Event
 	// Errors returns the channel of errors.
 	Errors() <-chan error
-	// Close stops watching and releases resources.
+	// Backend returns the mechanism used to detect changes.
+	Backend() Backend
+	// Stats returns counters describing the current watch state.
+	Stats() Stats
+	// Close stops watching and releases resources. Events still waiting
+	// for the debounce delay are delivered to Events before it returns.
 	Close() error
 }
 
+// Stats describes the current watch state of a Watcher.
+type Stats struct {
+	// WatchedDirs is the number of directories watched recursively.
+	WatchedDirs int
+	// PolledDirs is the number of directories polled because a system
+	// limit on watches was reached.
+	PolledDirs int
+	// DroppedEvents counts events dropped because the Events channel was full.
+	DroppedEvents uint64
+	// DroppedErrors counts errors dropped because the Errors channel was full.
+	DroppedErrors uint64
+	// Overflows counts the times the operating system reported lost events.
+	Overflows uint64
+}
+
+// counters are the Stats counters of a watcher, shared with its debouncer.
+type counters struct {
+	droppedEvents atomic.Uint64
+	droppedErrors atomic.Uint64
+	overflows     atomic.Uint64
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		DroppedEvents: c.droppedEvents.Load(),
+		DroppedErrors: c.droppedErrors.Load(),
+		Overflows:     c.overflows.Load(),
+	}
+}
+
+// Backend selects how file changes are detected.
+type Backend string
+
+// Backends.
+const (
+	// BackendFSNotify uses the operating system's change notifications.
+	BackendFSNotify Backend = "fsnotify"
+	// BackendPoll periodically scans the watched files.
+	BackendPoll Backend = "poll"
+	// BackendAuto uses fsnotify unless a probe write into the first watched
+	// directory is not reported, in which case it falls back to polling.
+	BackendAuto Backend = "auto"
+)
+
 // Config holds watcher configuration.
 type Config struct {
-	Dirs         []string
-	Filter       Filter
-	Debounce     time.Duration
-	Root         string
-	ExcludeDirs  []string
+	Dirs        []string
+	Filter      Filter
+	Debounce    time.Duration
+	Root        string
+	ExcludeDirs []string
+	// Files are individual files to watch in addition to Dirs. Their parent
+	// directories are watched non-recursively so that files replaced by
+	// atomic saves are still reported. Files bypass the Filter.
+	Files []string
+	// Backend selects the change detection mechanism. It defaults to fsnotify.
+	Backend Backend
+	// PollInterval is the scan interval of the polling backend.
+	PollInterval time.Duration
+	// PollHash makes the polling backend compare file contents in addition
+	// to modification times and sizes.
+	PollHash bool
+	// IgnoreOps lists operations that never produce an event.
+	IgnoreOps Op
+	// IgnoreUnchanged keeps a content hash per watched file and drops events
+	// after which the content is the same, such as touches, chmods and
+	// rewrites with identical content.
+	IgnoreUnchanged bool
+	// IgnoreEditorFiles drops events for the backup, swap and temporary
+	// files that editors write while saving.
+	IgnoreEditorFiles bool
+	// PollOverflow polls the directories that cannot be watched once a
+	// system limit on watches is reached, instead of failing with a
+	// *LimitError.
+	PollOverflow bool
+	// Flat watches each of Dirs without its subdirectories.
+	Flat bool
+	// FollowSymlinks watches the directories that symbolic links below Dirs
+	// point to. Their events are reported under the link's path. A directory
+	// reached by more than one path is watched once.
+	FollowSymlinks bool
+	// Constraints, if set, drops events for Go files that build constraints
+	// exclude from the build and that were excluded before the change too.
+	Constraints *BuildConstraints
+	// OnSkip, if set, is called with the reason for every event dropped
+	// because of Constraints.
+	OnSkip func(path, reason string)
+	// Hold, if set, is asked before debounced events are delivered. While it
+	// reports true, for example during a git checkout, events are held back
+	// and delivered together once it reports false.
+	Hold func() bool
+	// DebounceMode selects when debounced events are delivered. It defaults
+	// to DebounceTrailing.
+	DebounceMode DebounceMode
+	// MaxWait, if positive, caps how long a stream of events can postpone
+	// delivery in trailing mode.
+	MaxWait time.Duration
+	// AdaptiveDebounce stretches the debounce delay up to four times for
+	// batches with many events, such as a branch switch or code generation.
+	AdaptiveDebounce bool
+	// Embeds are //go:embed patterns whose files are watched whatever the
+	// Filter and ExcludeDirs say. The directories they can match in are
+	// watched recursively, even with Flat.
+	Embeds []EmbedPattern
+	// ExcludePaths are absolute directories, such as the build output
+	// directory, that are never watched, not even for Embeds.
+	ExcludePaths []string
+}
+
+func (c *Config) absPath(path string) string {
+	if !filepath.IsAbs(path) && c.Root != "" {
+		return filepath.Join(c.Root, path)
+	}
+	return filepath.Clean(path)
+}
+
+// roots returns the absolute directories to walk: Dirs and the package
+// directories of Embeds outside them.
+func (c *Config) roots() []string {
+	var roots []string
+	for _, dir := range c.Dirs {
+		roots = append(roots, c.absPath(dir))
+	}
+	n := len(roots)
+	for _, dir := range embedPatterns(c.Embeds).dirs() {
+		if !slices.ContainsFunc(roots[:n], func(root string) bool { return isWithin(dir, root) }) {
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// match reports whether the file at path is watched: it is outside
+// ExcludePaths and passes the Filter or is selected by one of Embeds.
+func (c *Config) match(path string) bool {
+	if c.isExcludedPath(path) {
+		return false
+	}
+	if embedPatterns(c.Embeds).match(path) {
+		return true
+	}
+	return c.Filter == nil || c.Filter.Match(path)
+}
+
+// skipDir reports whether a walk from root leaves dir and everything below
+// it unwatched.
+func (c *Config) skipDir(dir, root string) bool {
+	if c.isExcludedPath(dir) {
+		return true
+	}
+	if embedPatterns(c.Embeds).covers(dir) {
+		return false
+	}
+	return c.isExcludedDir(dir) || (c.Flat && dir != root)
+}
+
+// isExcludedPath reports whether path is in one of ExcludePaths.
+func (c *Config) isExcludedPath(path string) bool {
+	return slices.ContainsFunc(c.ExcludePaths, func(dir string) bool {
+		return isWithin(path, filepath.Clean(dir))
+	})
+}
+
+func (c *Config) isExcludedDir(path string) bool {
+	if c.Filter != nil && c.Filter.SkipDir(path) {
+		return true
+	}
+	base := filepath.Base(path)
+	for _, excluded := range c.ExcludeDirs {
+		if base == excluded {
+			return true
+		}
+	}
+	return false
 }
 
 type watcher struct {
@@ -77,22 +265,59 @@ type watcher struct {
 	done    chan struct{}
 	mu      sync.Mutex
 	started bool
+
+	// dirs holds directories watched recursively; files holds the
+	// individually watched files from Config.Files.
+	dirs  map[string]bool
+	files map[string]bool
+
+	changes *changeFilter
+	deb     *debouncer
+	// walker is only used by Start and the event loop.
+	walker *walker
+	counters
+
+	// overflow polls the directories beyond the system watch limit.
+	overflow *poller
 }
 
 // New creates a new Watcher with the given configuration.
 func New(cfg Config) (Watcher, error) {
+	switch cfg.Backend {
+	case BackendPoll:
+		return newPoller(cfg), nil
+	case BackendAuto:
+		if !probeNotify(cfg) {
+			return newPoller(cfg), nil
+		}
+	}
+	return newNotifyWatcher(cfg)
+}
+
+func newNotifyWatcher(cfg Config) (Watcher, error) {
 	fw, err := fsnotify.NewWatcher()
 	if err != nil {
+		if isLimitError(err) {
+			err = &LimitError{InUse: -1, Err: err}
+		}
 		return nil, fmt.Errorf("create fsnotify watcher: %w", err)
 	}
 
-	return &watcher{
-		cfg:    cfg,
-		fw:     fw,
-		events: make(chan Event, 100),
-		errors: make(chan error, 10),
-		done:   make(chan struct{}),
-	}, nil
+	w := &watcher{
+		cfg:     cfg,
+		fw:      fw,
+		events:  make(chan Event, 100),
+		errors:  make(chan error, 10),
+		done:    make(chan struct{}),
+		dirs:    make(map[string]bool),
+		files:   make(map[string]bool),
+		changes: newChangeFilter(cfg),
+		walker:  newWalker(cfg.FollowSymlinks),
+	}
+	w.deb = newDebouncerFor(cfg, w.events)
+	w.deb.keep = w.changes.keep
+	w.deb.dropped = &w.droppedEvents
+	return w, nil
 }
 
 func (w *watcher) Start(ctx context.Context) error {
@@ -105,13 +330,27 @@ func (w *watcher) Start(ctx context.Context) error {
 	w.mu.Unlock()
 
 	// Add directories to watch.
-	for _, dir := range w.cfg.Dirs {
-		if !filepath.IsAbs(dir) && w.cfg.Root != "" {
-			dir = filepath.Join(w.cfg.Root, dir)
+	var ov overflow
+	for _, dir := range w.cfg.roots() {
+		if err := w.addRecursive(dir, false, &ov); err != nil {
+			return fmt.Errorf("add watch directory %s: %w", dir, err)
 		}
+	}
 
-		if err := w.addRecursive(dir); err != nil {
-			return fmt.Errorf("add watch directory %s: %w", dir, err)
+	// Add individual files by watching their parent directories.
+	for _, file := range w.cfg.Files {
+		file = w.cfg.absPath(file)
+		if err := w.addFile(file, &ov); err != nil {
+			return fmt.Errorf("add watch file %s: %w", file, err)
+		}
+	}
+
+	if ov.err != nil {
+		if !w.cfg.PollOverflow {
+			return w.limitError(&ov)
+		}
+		if err := w.pollOverflow(ctx, &ov); err != nil {
+			return err
 		}
 	}
 
@@ -120,78 +359,195 @@ func (w *watcher) Start(ctx context.Context) error {
 	return nil
 }
 
-func (w *watcher) addRecursive(root string) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+// addRecursive watches root and every directory below it that is not
+// excluded. Matching files are recorded as existing, or, with announce, reported
+// as created, for directories moved into the tree. Once a system limit on
+// watches is reached, the remaining directories are collected in ov.
+func (w *watcher) addRecursive(root string, announce bool, ov *overflow) error {
+	return w.walker.walk(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			// Files may disappear while walking.
+			if os.IsNotExist(err) && path != root {
+				return nil
+			}
 			return err
 		}
 
-		if !info.IsDir() {
+		if !d.IsDir() {
+			if ov.contains(filepath.Dir(path)) {
+				return nil
+			}
+			if !w.cfg.match(path) {
+				return nil
+			}
+			if w.cfg.IgnoreEditorFiles && isEditorTemp(path) {
+				return nil
+			}
+			if announce {
+				w.deb.add(Event{Path: path, Op: OpCreate, Time: time.Now()})
+			} else {
+				w.deb.seen(path)
+				w.changes.seed(path)
+			}
 			return nil
 		}
 
 		// Skip excluded directories.
-		if w.isExcludedDir(path) {
+		if w.cfg.skipDir(path, root) {
 			return filepath.SkipDir
 		}
 
+		// Past the limit, only count what is left.
+		if ov.err != nil {
+			ov.add(path)
+			return nil
+		}
 		if err := w.fw.Add(path); err != nil {
+			if isLimitError(err) {
+				ov.err = err
+				ov.add(path)
+				return nil
+			}
 			return fmt.Errorf("add %s to watcher: %w", path, err)
 		}
+		w.mu.Lock()
+		w.dirs[path] = true
+		w.mu.Unlock()
 
 		return nil
 	})
 }
 
-func (w *watcher) isExcludedDir(path string) bool {
-	base := filepath.Base(path)
-	for _, excluded := range w.cfg.ExcludeDirs {
-		if base == excluded {
-			return true
+// addFile watches file through its parent directory. Once a system limit on
+// watches is reached, the file is collected in ov instead.
+func (w *watcher) addFile(file string, ov *overflow) error {
+	if ov.err == nil {
+		if err := w.fw.Add(filepath.Dir(file)); err != nil {
+			if !isLimitError(err) {
+				return err
+			}
+			ov.err = err
 		}
 	}
-	return false
+	if ov.err != nil {
+		ov.files = append(ov.files, file)
+		return nil
+	}
+
+	w.files[file] = true
+	// A file may be created later.
+	if _, err := os.Stat(file); err == nil {
+		w.deb.seen(file)
+		w.changes.seed(file)
+	}
+	return nil
 }
 
-func (w *watcher) loop(ctx context.Context) {
-	var (
-		debounceTimer *time.Timer
-		pendingEvents = make(map[string]Event)
-		mu            sync.Mutex
-	)
-
-	debounce := w.cfg.Debounce
-	if debounce <= 0 {
-		debounce = 100 * time.Millisecond
-	}
-
-	flushEvents := func() {
-		mu.Lock()
-		defer mu.Unlock()
-
-		for _, evt := range pendingEvents {
-			select {
-			case w.events <- evt:
-			default:
-				// Channel full, drop oldest events.
-			}
+// removeRecursive forgets dir and every watched directory below it, and
+// reports the files known below it as removed. The kernel drops watches of
+// deleted directories itself, so errors from removing them are ignored.
+func (w *watcher) removeRecursive(dir string) {
+	prefix := dir + string(filepath.Separator)
+
+	w.mu.Lock()
+	for path := range w.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			_ = w.fw.Remove(path)
+			delete(w.dirs, path)
 		}
-		pendingEvents = make(map[string]Event)
+	}
+	w.mu.Unlock()
+
+	w.walker.forget(dir)
+	w.deb.removeBelow(dir, time.Now())
+}
+
+// handleDir keeps the set of watched directories in sync with a directory
+// event. It reports whether the event concerned a watched directory and has
+// been handled.
+func (w *watcher) handleDir(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		if !w.dirs[event.Name] {
+			return false
+		}
+		w.removeRecursive(event.Name)
+		return true
+	}
+
+	if !event.Has(fsnotify.Create) || !w.dirs[filepath.Dir(event.Name)] {
+		return false
+	}
+	info, err := os.Stat(event.Name)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	if w.cfg.skipDir(event.Name, "") {
+		return true
+	}
+	// A directory moved into the tree may already contain files and
+	// subdirectories, which never produce events of their own.
+	var ov overflow
+	if err := w.addRecursive(event.Name, true, &ov); err != nil {
+		w.sendError(err)
+	} else if ov.err != nil {
+		w.sendError(w.limitError(&ov))
+	}
+	return true
+}
+
+// limitError describes the directories left unwatched in ov.
+func (w *watcher) limitError(ov *overflow) *LimitError {
+	w.mu.Lock()
+	watched := len(w.dirs)
+	w.mu.Unlock()
+
+	e := &LimitError{
+		Watched: watched,
+		Total:   watched + ov.dirs + len(ov.files),
+		InUse:   -1,
+		Err:     ov.err,
+	}
+	if n, ok := watchLimit(); ok {
+		e.Max = n
+	}
+	if n, ok := watchesInUse(); ok {
+		e.InUse = n
+	}
+	return e
+}
+
+// pollOverflow starts a poller for the directories and files in ov. It reports to the
+// watcher's own channels.
+func (w *watcher) pollOverflow(ctx context.Context, ov *overflow) error {
+	cfg := w.cfg
+	cfg.Dirs = ov.roots
+	cfg.Files = ov.files
+
+	p := newPollerWith(cfg, w.events, w.errors)
+	// The packages of embed patterns are walked by w itself.
+	p.roots = ov.roots
+	if err := p.Start(ctx); err != nil {
+		return fmt.Errorf("poll overflow directories: %w", err)
 	}
 
+	w.mu.Lock()
+	w.overflow = p
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *watcher) loop(ctx context.Context) {
+	deb := w.deb
+
 	for {
 		select {
 		case <-ctx.Done():
-			if debounceTimer != nil {
-				debounceTimer.Stop()
-			}
-			flushEvents()
+			deb.stop()
+			deb.flush()
 			return
 
 		case <-w.done:
-			if debounceTimer != nil {
-				debounceTimer.Stop()
-			}
+			deb.stop()
 			return
 
 		case event, ok := <-w.fw.Events:
@@ -199,45 +555,42 @@ func (w *watcher) loop(ctx context.Context) {
 				return
 			}
 
-			// Skip if filter doesn't match.
-			if w.cfg.Filter != nil && !w.cfg.Filter.Match(event.Name) {
+			if w.cfg.IgnoreEditorFiles && isEditorTemp(event.Name) {
 				continue
 			}
 
-			// Handle directory creation - add to watch.
-			if event.Has(fsnotify.Create) {
-				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-					if !w.isExcludedDir(event.Name) {
-						_ = w.fw.Add(event.Name)
-					}
-				}
+			// Directory events only update the watched set; they are never
+			// subject to the file filter.
+			if w.handleDir(event) {
+				continue
 			}
 
-			// Convert fsnotify operation to our Op type.
-			op := convertOp(event.Op)
+			// Individually watched files bypass the filter. Other events from
+			// directories that are only watched for those files are skipped.
+			if !w.files[event.Name] {
+				if !w.dirs[filepath.Dir(event.Name)] {
+					continue
+				}
+				if !w.cfg.match(event.Name) {
+					continue
+				}
+			}
 
-			mu.Lock()
-			pendingEvents[event.Name] = Event{
+			deb.add(Event{
 				Path: event.Name,
-				Op:   op,
+				Op:   convertOp(event.Op),
 				Time: time.Now(),
-			}
-
-			if debounceTimer == nil {
-				debounceTimer = time.AfterFunc(debounce, flushEvents)
-			} else {
-				debounceTimer.Reset(debounce)
-			}
-			mu.Unlock()
+			})
 
 		case err, ok := <-w.fw.Errors:
 			if !ok {
 				return
 			}
-			select {
-			case w.errors <- err:
-			default:
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.rescan()
+				continue
 			}
+			w.sendError(err)
 		}
 	}
 }
@@ -259,6 +612,64 @@ func convertOp(op fsnotify.Op) Op {
 	}
 }
 
+// rescan recovers from lost events: it forgets directories that no longer
+// exist, watches new ones and reports an OpRescan so that everything is
+// rebuilt.
+func (w *watcher) rescan() {
+	w.overflows.Add(1)
+
+	w.mu.Lock()
+	var gone []string
+	for dir := range w.dirs {
+		if _, err := os.Stat(dir); err != nil {
+			gone = append(gone, dir)
+		}
+	}
+	w.mu.Unlock()
+	for _, dir := range gone {
+		w.removeRecursive(dir)
+	}
+
+	var ov overflow
+	for _, dir := range w.cfg.roots() {
+		if err := w.addRecursive(dir, false, &ov); err != nil {
+			w.sendError(fmt.Errorf("rescan %s: %w", dir, err))
+		}
+	}
+	if ov.err != nil {
+		w.sendError(w.limitError(&ov))
+	}
+
+	w.deb.add(Event{Path: w.cfg.absPath("."), Op: OpRescan, Time: time.Now()})
+}
+
+func (w *watcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+		w.droppedErrors.Add(1)
+	}
+}
+
+func (w *watcher) Backend() Backend {
+	return BackendFSNotify
+}
+
+func (w *watcher) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := w.counters.stats()
+	stats.WatchedDirs = len(w.dirs)
+	if w.overflow != nil {
+		o := w.overflow.Stats()
+		stats.PolledDirs = o.WatchedDirs
+		stats.DroppedEvents += o.DroppedEvents
+		stats.DroppedErrors += o.DroppedErrors
+	}
+	return stats
+}
+
 func (w *watcher) Events() <-chan Event {
 	return w.events
 }
@@ -276,7 +687,12 @@ func (w *watcher) Close() error {
 		// Already closed.
 	default:
 		close(w.done)
+		w.deb.stop()
+		w.deb.flush()
 	}
 
+	if w.overflow != nil {
+		_ = w.overflow.Close()
+	}
 	return w.fw.Close()
 }
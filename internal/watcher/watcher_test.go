@@ -2,8 +2,10 @@ package watcher
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -106,6 +108,57 @@ func TestWatcher_Events(t *testing.T) {
 	}
 }
 
+func TestWatcher_CloseDeliversPending(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, backend := range []Backend{BackendFSNotify, BackendPoll} {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := filepath.Join(tmpDir, string(backend))
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatalf("mkdir: %v", err)
+			}
+
+			w, err := New(Config{
+				Dirs:         []string{"."},
+				Filter:       NewFilter(FilterConfig{Extensions: []string{".go"}, Root: dir}),
+				Debounce:     10 * time.Second,
+				Root:         dir,
+				Backend:      backend,
+				PollInterval: 20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := w.Start(ctx); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+
+			goFile := filepath.Join(dir, "main.go")
+			if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+			time.Sleep(200 * time.Millisecond)
+
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			select {
+			case evt := <-w.Events():
+				if evt.Path != goFile {
+					t.Errorf("Event path = %v, want %v", evt.Path, goFile)
+				}
+			default:
+				t.Error("Close() did not deliver the pending event")
+			}
+		})
+	}
+}
+
 func TestWatcher_FilteredEvents(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -165,6 +218,136 @@ func TestWatcher_FilteredEvents(t *testing.T) {
 	}
 }
 
+func TestWatcher_FilesBypassFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Embedded assets are watched as Files inside a watched directory.
+	tmplDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(tmplDir, 0755); err != nil {
+		t.Fatalf("create templates dir: %v", err)
+	}
+	index := filepath.Join(tmplDir, "index.html")
+	other := filepath.Join(tmplDir, "other.html")
+	for _, path := range []string{index, other} {
+		if err := os.WriteFile(path, []byte("<html>"), 0644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+
+	w, err := New(Config{
+		Dirs:     []string{"."},
+		Filter:   NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce: 50 * time.Millisecond,
+		Root:     tmpDir,
+		Files:    []string{index},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if err := os.WriteFile(other, []byte("<html>other"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.WriteFile(index, []byte("<html>index"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != index {
+			t.Errorf("Event path = %v, want %v", evt.Path, index)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Timeout waiting for event")
+	}
+
+	select {
+	case evt := <-w.Events():
+		t.Errorf("Unexpected event for a filtered file: %v", evt)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatcher_FilesOutsideDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatalf("create src dir: %v", err)
+	}
+	makefile := filepath.Join(tmpDir, "Makefile")
+	if err := os.WriteFile(makefile, []byte("all:\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	w, err := New(Config{
+		Dirs:     []string{"src"},
+		Filter:   NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce: 50 * time.Millisecond,
+		Root:     tmpDir,
+		Files:    []string{"Makefile", ".env"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	expect := func(path string, op Op) {
+		t.Helper()
+		select {
+		case evt := <-w.Events():
+			if evt.Path != path || evt.Op != op {
+				t.Errorf("Event = %v %v, want %v %v", evt.Op, evt.Path, op, path)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("Timeout waiting for %v %v", op, path)
+		}
+	}
+
+	// An atomic save replaces the file; it is still followed.
+	for i := range 2 {
+		tmp := filepath.Join(tmpDir, ".Makefile.tmp")
+		if err := os.WriteFile(tmp, []byte(fmt.Sprintf("all: %d\n", i)), 0644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+		if err := os.Rename(tmp, makefile); err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+		expect(makefile, OpWrite)
+	}
+
+	// A file that does not exist yet is reported once created.
+	env := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(env, []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	expect(env, OpCreate)
+
+	// Other files next to them are not.
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	select {
+	case evt := <-w.Events():
+		t.Errorf("unexpected event outside the watched directories: %+v", evt)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
 func TestWatcher_ExcludeDirs(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -207,6 +390,95 @@ func TestWatcher_ExcludeDirs(t *testing.T) {
 	}
 }
 
+func TestConfig_ExcludePaths(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "project")
+	out := filepath.Join(root, "build", "out")
+	c := &Config{
+		Filter: NewFilter(FilterConfig{
+			Extensions: []string{".go"},
+			Root:       root,
+		}),
+		Root:         root,
+		ExcludePaths: []string{out + string(filepath.Separator)},
+		// The pattern covers the excluded directory, which still wins.
+		Embeds: []EmbedPattern{{Dir: filepath.Join(root, "build"), Pattern: "all:out"}},
+	}
+
+	tests := []struct {
+		path    string
+		match   bool
+		skipDir bool
+	}{
+		{filepath.Join(root, "main.go"), true, false},
+		{filepath.Join(root, "build", "gen.go"), true, false},
+		{out, false, true},
+		{filepath.Join(out, "gen.go"), false, true},
+		{filepath.Join(out, "nested", "gen.go"), false, true},
+		{out + "put.go", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := c.match(tt.path); got != tt.match {
+				t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.match)
+			}
+			if got := c.skipDir(tt.path, root); got != tt.skipDir {
+				t.Errorf("skipDir(%q) = %v, want %v", tt.path, got, tt.skipDir)
+			}
+		})
+	}
+}
+
+func TestWatcher_Files(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "goreload.yaml")
+	if err := os.WriteFile(configFile, []byte("root: ."), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	w, err := New(Config{
+		Debounce: 50 * time.Millisecond,
+		Root:     tmpDir,
+		Files:    []string{"goreload.yaml"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Other files in the parent directory should not trigger events.
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		t.Errorf("Should not receive event for unwatched file, got: %v", evt)
+	case <-time.After(200 * time.Millisecond):
+		// Expected - no event
+	}
+
+	if err := os.WriteFile(configFile, []byte("root: ./app"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != configFile {
+			t.Errorf("Event path = %v, want %v", evt.Path, configFile)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Timeout waiting for event")
+	}
+}
+
 func TestWatcher_ContextCancellation(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -258,6 +530,7 @@ func TestOp_String(t *testing.T) {
 		{OpRemove, "REMOVE"},
 		{OpRename, "RENAME"},
 		{OpChmod, "CHMOD"},
+		{OpRescan, "RESCAN"},
 		{Op(999), "UNKNOWN"},
 	}
 
@@ -269,3 +542,334 @@ func TestOp_String(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcher_Directories(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+
+	w, err := New(Config{
+		Dirs:     []string{"."},
+		Filter:   NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce: 50 * time.Millisecond,
+		Root:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := w.Stats().WatchedDirs; got != 1 {
+		t.Fatalf("WatchedDirs = %d, want 1", got)
+	}
+
+	expect := func(path string, op Op) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case evt := <-w.Events():
+				if evt.Path == path && evt.Op == op {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timeout waiting for %v %s", op, path)
+			}
+		}
+	}
+
+	// Move a package with a nested directory into the tree.
+	src := filepath.Join(outside, "newpkg")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "sub.go"), []byte("package sub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(tmpDir, "newpkg")
+	if err := os.Rename(src, pkg); err != nil {
+		t.Fatal(err)
+	}
+	subFile := filepath.Join(pkg, "sub", "sub.go")
+	expect(subFile, OpCreate)
+	if got := w.Stats().WatchedDirs; got != 3 {
+		t.Errorf("WatchedDirs after move in = %d, want 3", got)
+	}
+
+	// Files in the nested directory are watched.
+	if err := os.WriteFile(subFile, []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(subFile, OpWrite)
+
+	// Moving the package out of the tree drops its watches.
+	if err := os.Rename(pkg, filepath.Join(outside, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	expect(subFile, OpRemove)
+	if got := w.Stats().WatchedDirs; got != 1 {
+		t.Errorf("WatchedDirs after move out = %d, want 1", got)
+	}
+}
+
+func TestWatcher_Rescan(t *testing.T) {
+	tmpDir := t.TempDir()
+	gone := filepath.Join(tmpDir, "gone")
+	if err := os.Mkdir(gone, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	nw, err := newNotifyWatcher(Config{
+		Dirs:     []string{"."},
+		Debounce: 20 * time.Millisecond,
+		Root:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("newNotifyWatcher() error = %v", err)
+	}
+	w := nw.(*watcher)
+	defer w.Close()
+
+	if err := w.addRecursive(tmpDir, false, &overflow{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Change the tree without the watcher seeing it, as after a queue overflow.
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "new", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w.rescan()
+
+	select {
+	case evt := <-w.Events():
+		if evt.Op != OpRescan || evt.Path != tmpDir {
+			t.Errorf("event = %v %v, want %v %v", evt.Op, evt.Path, OpRescan, tmpDir)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for rescan event")
+	}
+
+	stats := w.Stats()
+	if stats.WatchedDirs != 3 {
+		t.Errorf("WatchedDirs = %d, want 3", stats.WatchedDirs)
+	}
+	if stats.Overflows != 1 {
+		t.Errorf("Overflows = %d, want 1", stats.Overflows)
+	}
+}
+
+func TestDebouncer_Dropped(t *testing.T) {
+	out := make(chan Event, 1)
+	d := newDebouncer(time.Hour, out)
+	var dropped atomic.Uint64
+	d.dropped = &dropped
+
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		d.add(Event{Path: name, Op: OpWrite})
+	}
+	d.stop()
+	d.flush()
+
+	if len(out) != 1 {
+		t.Errorf("delivered %d events, want 1", len(out))
+	}
+	if got := dropped.Load(); got != 2 {
+		t.Errorf("dropped = %d, want 2", got)
+	}
+}
+
+func TestDebouncer_WriteThenChmod(t *testing.T) {
+	out := make(chan Event, 2)
+	d := newDebouncer(time.Hour, out)
+	d.keep = newChangeFilter(Config{IgnoreOps: OpChmod}).keep
+
+	d.add(Event{Path: "a.go", Op: OpWrite})
+	d.add(Event{Path: "a.go", Op: OpChmod})
+	d.add(Event{Path: "b.go", Op: OpChmod})
+	d.stop()
+	d.flush()
+
+	if len(out) != 1 {
+		t.Fatalf("delivered %d events, want 1", len(out))
+	}
+	if evt := <-out; evt.Path != "a.go" || evt.Op != OpWrite {
+		t.Errorf("delivered %s %s, want a.go WRITE", evt.Path, evt.Op)
+	}
+}
+
+func TestDebouncer_Hold(t *testing.T) {
+	out := make(chan Event, 2)
+	d := newDebouncer(20*time.Millisecond, out)
+	var dropped atomic.Uint64
+	d.dropped = &dropped
+	var holding atomic.Bool
+	holding.Store(true)
+	d.hold = holding.Load
+	defer d.stop()
+
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		d.add(Event{Path: name, Op: OpWrite})
+	}
+
+	select {
+	case evt := <-out:
+		t.Fatalf("event delivered while held: %+v", evt)
+	case <-time.After(3 * holdInterval):
+	}
+
+	// More events are collected while held.
+	d.add(Event{Path: "d.go", Op: OpWrite})
+	holding.Store(false)
+
+	time.Sleep(3 * holdInterval)
+	if n := len(out); n != cap(out) {
+		t.Errorf("delivered %d events, want the buffer filled with %d", n, cap(out))
+	}
+	// The overflow of a release is handled as one batch, not lost.
+	if got := dropped.Load(); got != 0 {
+		t.Errorf("dropped = %d, want 0", got)
+	}
+}
+
+func TestDebouncer_MaxWait(t *testing.T) {
+	out := make(chan Event, 10)
+	d := newDebouncer(100*time.Millisecond, out)
+	d.maxWait = 300 * time.Millisecond
+	defer d.stop()
+
+	// A file written more often than the delay would postpone delivery
+	// forever without a cap.
+	start := time.Now()
+	stop := time.After(time.Second)
+loop:
+	for {
+		select {
+		case <-out:
+			break loop
+		case <-stop:
+			t.Fatal("no event delivered while events kept arriving")
+		case <-time.After(20 * time.Millisecond):
+			d.add(Event{Path: "state.json", Op: OpWrite})
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Errorf("delivered after %v, want about max_wait", elapsed)
+	}
+}
+
+func TestDebouncer_Leading(t *testing.T) {
+	out := make(chan Event, 10)
+	d := newDebouncer(200*time.Millisecond, out)
+	d.leading = true
+	defer d.stop()
+
+	d.add(Event{Path: "a.go", Op: OpWrite})
+	select {
+	case evt := <-out:
+		if evt.Path != "a.go" {
+			t.Errorf("Event path = %v, want a.go", evt.Path)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("first event not delivered at once")
+	}
+
+	// Events within the window are delivered together when it ends.
+	d.add(Event{Path: "b.go", Op: OpWrite})
+	d.add(Event{Path: "c.go", Op: OpWrite})
+	select {
+	case evt := <-out:
+		t.Fatalf("event delivered within the window: %+v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := len(out); n != 2 {
+		t.Errorf("delivered %d events at the end of the window, want 2", n)
+	}
+}
+
+func TestDebouncer_Window(t *testing.T) {
+	tests := []struct {
+		name     string
+		adaptive bool
+		count    int
+		want     time.Duration
+	}{
+		{"fixed", false, 100, 100 * time.Millisecond},
+		{"single event", true, 1, 100 * time.Millisecond},
+		{"burst", true, 25, 300 * time.Millisecond},
+		{"capped", true, 1000, 400 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDebouncer(100*time.Millisecond, make(chan Event))
+			d.adaptive = tt.adaptive
+			d.count = tt.count
+			if got := d.window(); got != tt.want {
+				t.Errorf("window() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_Flat(t *testing.T) {
+	tmpDir := t.TempDir()
+	sub := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(Config{
+		Dirs:     []string{"."},
+		Filter:   NewFilter(FilterConfig{Extensions: []string{".go"}, Root: tmpDir}),
+		Debounce: 50 * time.Millisecond,
+		Root:     tmpDir,
+		Flat:     true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := w.Stats().WatchedDirs; got != 1 {
+		t.Errorf("WatchedDirs = %d, want 1", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(sub, "sub.go"), []byte("package sub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	goFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case evt := <-w.Events():
+		if evt.Path != goFile {
+			t.Errorf("Event path = %v, want %v", evt.Path, goFile)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Timeout waiting for event")
+	}
+	select {
+	case evt := <-w.Events():
+		t.Errorf("unexpected event from subdirectory: %v", evt.Path)
+	case <-time.After(200 * time.Millisecond):
+	}
+}